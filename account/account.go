@@ -1,170 +1,254 @@
 package account
 
 import (
-    "os"
-    "path/filepath"
     "encoding/json"
     "compress/gzip"
-    "io/ioutil"
     "bytes"
+    "errors"
+    "fmt"
 
     "github.com/thomasbeukema/dargent/address"
+    "github.com/thomasbeukema/dargent/store"
 )
 
 type Account struct {
     Type        address.AccountType
     PublicKey   []byte
     Address     string
-    Currencies  []string
+    Currencies  []string    // Tickers of the ledgers holding txs, in the order they got them
+    store       store.Store // Where the account and its ledgers are kept
 }
 
-// Simple function whichc checks whether file exists
-func pathExists(path string) bool {
-    if _, err := os.Stat(path); os.IsNotExist(err) {
-        return false
-    } else if _, err := os.Stat(path); err == nil {
-        return true
-    } else {
-        // TODO: Handle unexpected err
-        return false
+// Keys of the account and its ledgers in the store; with a FileStore this is
+// <address>/index.json.gz and <address>/<currency>/index.json.gz
+func accountKey(addr string) string {
+    return store.Key(addr, "index.json.gz")
+}
+
+func ledgerKey(addr string, currency string) string {
+    return store.Key(addr, currency, "index.json.gz")
+}
+
+// Read gzipped JSON stored under key into v. Errors of the store are
+// returned as is, content which can't be decoded gives ErrBadEncoding.
+func readGzipJSON(s store.Store, key string, v interface{}) error {
+    gzipped, err := s.Get(key)
+    if err != nil {
+        return err
     }
+
+    gzipReader, err := gzip.NewReader(bytes.NewReader(gzipped))
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrBadEncoding, err)
+    }
+    defer gzipReader.Close()
+
+    var content bytes.Buffer
+    if _, err := content.ReadFrom(gzipReader); err != nil {
+        return fmt.Errorf("%w: %v", ErrBadEncoding, err)
+    }
+
+    if err := json.Unmarshal(content.Bytes(), v); err != nil {
+        return fmt.Errorf("%w: %v", ErrBadEncoding, err)
+    }
+
+    return nil
 }
 
-func getPathByAddress(key string) string {
-    wd, err := os.Getwd()
+// Store v as gzipped JSON under key
+func writeGzipJSON(s store.Store, key string, v interface{}) error {
+    content, err := json.Marshal(v)
     if err != nil {
-        // TODO: Proper err handling
-        panic(err)
+        return err
     }
 
-    return filepath.Join(wd, "data", key)
+    var gzipped bytes.Buffer
+    gzipper := gzip.NewWriter(&gzipped)
+    gzipper.Write(content)
+    gzipper.Close()
+
+    return s.Put(key, gzipped.Bytes())
 }
 
-// TODO: Determine t by PublicKey automatically
-func OpenAccount(addr string, publicKey []byte) Account {
-    path := getPathByAddress(addr)
-    var t address.AccountType = address.TypeOfAddress(addr)
+// List addresses of all accounts in the store
+func ListAccounts(s store.Store) ([]string, error) {
+    addrs := make([]string, 0)
 
-    if pathExists(path) { // Already opened this account, return saved data
-        f, err := os.Open(filepath.Join(path, "index.json.gz"))
-        defer f.Close()
-        if err != nil {
-            // TODO: Proper err handling
-            panic(err)
+    names, err := s.List("")
+    if err != nil {
+        return nil, err
+    }
+    for _, name := range names {
+        if address.TypeOfAddress(name) != address.UNKNOWN && AccountExists(s, name) {
+            addrs = append(addrs, name)
         }
+    }
 
-        gzipReader, err := gzip.NewReader(f)
-        defer gzipReader.Close()
-        if err != nil {
-            // TODO: You guessed it... Proper err handling
-            panic(err)
-        }
+    return addrs, nil
+}
 
-        var content bytes.Buffer
-        content.ReadFrom(gzipReader)
+// List the currencies this account has a ledger for
+func (acc *Account) Ledgers() ([]string, error) {
+    currencies := make([]string, 0)
 
-        var acc Account
-        err = json.Unmarshal(content.Bytes(), &acc)
-        if err != nil {
-            // TODO: Proper err handling
-            panic(err)
+    names, err := acc.store.List(acc.Address)
+    if err != nil {
+        return nil, err
+    }
+    for _, name := range names {
+        if store.Exists(acc.store, ledgerKey(acc.Address, name)) {
+            currencies = append(currencies, name)
         }
+    }
 
-        return acc
+    return currencies, nil
+}
 
-    } else { // Return new account and save it to disk
-        acc := Account{
-            Type: t,
-            PublicKey: publicKey,
-            Address: addr,
-            Currencies: make([]string, 0),
-        }
+// Note that the account has a ledger of currency with txs in it
+func (acc *Account) addCurrency(currency string) error {
+    if containsString(acc.Currencies, currency) {
+        return nil
+    }
+
+    var stored Account // Other copies of acc may have added currencies too
+    if err := readGzipJSON(acc.store, accountKey(acc.Address), &stored); err != nil && err != store.ErrNotFound {
+        return err
+    }
+    if !containsString(stored.Currencies, currency) {
+        stored.Currencies = append(stored.Currencies, currency)
+    }
+    acc.Currencies = stored.Currencies
 
-        accountJson, err := json.Marshal(acc)
-        if err != nil {
-            // TODO
-            panic(err)
+    return writeGzipJSON(acc.store, accountKey(acc.Address), *acc)
+}
+
+func containsString(list []string, s string) bool {
+    for _, item := range list {
+        if item == s {
+            return true
         }
+    }
 
-        var gzipped bytes.Buffer
-        gzipper := gzip.NewWriter(&gzipped)
-        gzipper.Write(accountJson)
-        gzipper.Close()
+    return false
+}
 
-        os.MkdirAll(path, os.ModePerm)
-        ioutil.WriteFile(filepath.Join(path, "index.json.gz"), []byte(gzipped.String()), 0644)
+// Check whether the account has a ledger for currency
+func (acc *Account) HasLedger(currency string) bool {
+    return store.Exists(acc.store, ledgerKey(acc.Address, currency))
+}
 
-        return acc
-    }
+// Verifier for signatures made by the owner of the account, using the scheme
+// its Type is the tag of
+func (acc *Account) Verifier() (address.Verifier, error) {
+    return address.NewVerifier(acc.Type, acc.PublicKey)
 }
 
-func (acc *Account) getLedgerPath(currency string) string {
-    path := getPathByAddress(acc.Address)
-    return filepath.Join(path, currency)
+// Check whether an account has been opened before
+func AccountExists(s store.Store, addr string) bool {
+    return store.Exists(s, accountKey(addr))
 }
 
-func (acc *Account) OpenLedger(currency string) Ledger {
-    ledgerPath := acc.getLedgerPath(currency)
+// Open the account at addr. When it doesn't exist yet it's created with
+// publicKey; without a key ErrAccountNotFound is returned.
+// TODO: Determine t by PublicKey automatically
+func OpenAccount(s store.Store, addr string, publicKey []byte) (Account, error) {
+    if normalized, err := address.Normalize(addr); err == nil { // Stored under the address of this network
+        addr = normalized
+    }
 
-    if pathExists(ledgerPath) { // Already created ledger
-        f, err := os.Open(filepath.Join(ledgerPath, "index.json.gz"))
-        defer f.Close()
-        if err != nil {
-            // TODO: Proper err handling
-            panic(err)
-        }
+    var t address.AccountType = address.TypeOfAddress(addr)
 
-        gzipReader, err := gzip.NewReader(f)
-        defer gzipReader.Close()
-        if err != nil {
-            // TODO: You guessed it... Proper err handling
-            panic(err)
-        }
+    var acc Account
+    err := readGzipJSON(s, accountKey(addr), &acc)
+    if err == nil { // Already opened this account, return saved data
+        acc.store = s
+        return acc, nil
+    }
+    if errors.Is(err, ErrBadEncoding) {
+        return Account{}, fmt.Errorf("%w: %s: %v", ErrCorruptAccount, addr, err)
+    }
+    if err != store.ErrNotFound {
+        return Account{}, err
+    }
 
-        var content bytes.Buffer
-        content.ReadFrom(gzipReader)
+    if publicKey == nil {
+        return Account{}, ErrAccountNotFound
+    }
 
-        var led Ledger
-        err = json.Unmarshal(content.Bytes(), &led)
-        if err != nil {
-            // TODO: Proper err handling
-            panic(err)
-        }
+    // Return new account and save it to the store
+    acc = Account{
+        Type: t,
+        PublicKey: publicKey,
+        Address: addr,
+        Currencies: make([]string, 0),
+        store: s,
+    }
+
+    if err := writeGzipJSON(s, accountKey(addr), acc); err != nil {
+        return Account{}, err
+    }
+
+    return acc, nil
+}
 
-        return led
-    } else { // Create ledger
-        led := Ledger{
+// Open the ledger of currency, creating it when the account doesn't have it
+// yet. A ledger which can't be read is rebuilt from its journal.
+func (acc *Account) OpenLedger(currency string) (Ledger, error) {
+    var led Ledger
+    err := readGzipJSON(acc.store, ledgerKey(acc.Address, currency), &led)
+
+    if err == store.ErrNotFound { // Create ledger
+        led = Ledger{
             Currency: currency,
             TxList: make([]Transaction, 0),
         }
 
-        ledgerJson, err := json.Marshal(led)
-        if err != nil {
-            // TODO
-            panic(err)
+        if err := writeGzipJSON(acc.store, ledgerKey(acc.Address, currency), led); err != nil {
+            return Ledger{}, err
         }
 
-        var gzipped bytes.Buffer
-        gzipper := gzip.NewWriter(&gzipped)
-        gzipper.Write(ledgerJson)
-        gzipper.Close()
+        return led, nil
+    }
 
-        os.MkdirAll(ledgerPath, os.ModePerm)
+    if errors.Is(err, ErrBadEncoding) { // Corrupt, rebuild it from the journal
+        led, err = acc.RecoverLedger(currency)
+    }
+    if err != nil {
+        return Ledger{}, err
+    }
 
-        ioutil.WriteFile(filepath.Join(ledgerPath, "index.json.gz"), []byte(gzipped.String()), 0644)
+    led.journaled = len(led.TxList)
+    return led, nil
+}
 
-        return led
+// Get the base64 public key an account was created with
+func GetPublicKeyFromAddress(s store.Store, addr string) (string, error) {
+    acc, err := OpenAccount(s, addr, nil)
+    if err != nil {
+        return "", err
     }
-}
 
-func GetPublicKeyFromAddress(addr string) string {
-    acc := OpenAccount(addr, nil)
-    led := acc.OpenLedger(NativeCurrency().Ticker)
+    if !acc.HasLedger(NativeCurrency().Ticker) {
+        return "", ErrLedgerNotFound
+    }
+
+    led, err := acc.OpenLedger(NativeCurrency().Ticker)
+    if err != nil {
+        return "", err
+    }
+    if len(led.TxList) == 0 {
+        return "", ErrLedgerNotFound
+    }
 
-    return led.TxList[0].Origin
+    return led.TxList[0].Origin, nil
 }
 
-func (acc *Account) AddTransaction(tx Transaction) {
-    led := acc.OpenLedger(tx.Currency.Ticker)
-    led.addTransaction(tx, acc)
+// Add tx to the ledger of its currency, returns why it got rejected
+func (acc *Account) AddTransaction(tx Transaction) error {
+    led, err := acc.OpenLedger(tx.Currency.Ticker)
+    if err != nil {
+        return err
+    }
+
+    return led.addTransaction(tx, acc)
 }
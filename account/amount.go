@@ -0,0 +1,114 @@
+package account
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// Number of the smallest units of a currency; a currency with 3 decimals
+// holds 12345 units in "12.345". Arithmetic on amounts is checked, so a
+// balance can't wrap around.
+type Amount uint64
+
+const MaxAmount = Amount(math.MaxUint64)
+
+// Sum of a and b, ErrAmountOverflow when it doesn't fit
+func (a Amount) Add(b Amount) (Amount, error) {
+    if a > MaxAmount-b {
+        return 0, ErrAmountOverflow
+    }
+
+    return a + b, nil
+}
+
+// Difference of a and b, ErrAmountOverflow when b is larger than a
+func (a Amount) Sub(b Amount) (Amount, error) {
+    if b > a {
+        return 0, ErrAmountOverflow
+    }
+
+    return a - b, nil
+}
+
+// Sum of a and b, MaxAmount when it doesn't fit; for totals which only get
+// compared, like weights
+func (a Amount) addCapped(b Amount) Amount {
+    if sum, err := a.Add(b); err == nil {
+        return sum
+    }
+
+    return MaxAmount
+}
+
+// Write a with decimals digits after the point, leaving off trailing zeros:
+// 12345 with 3 decimals is "12.345", 12300 "12.3"
+func FormatAmount(a Amount, decimals uint8) string {
+    digits := strconv.FormatUint(uint64(a), 10)
+    if decimals == 0 {
+        return digits
+    }
+
+    if len(digits) <= int(decimals) { // Pad so there's a digit before the point
+        digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+    }
+
+    point := len(digits) - int(decimals)
+    fraction := strings.TrimRight(digits[point:], "0")
+    if fraction == "" {
+        return digits[:point]
+    }
+
+    return digits[:point] + "." + fraction
+}
+
+// Read an amount written like FormatAmount does; at most decimals digits
+// may follow the point
+func ParseAmount(s string, decimals uint8) (Amount, error) {
+    whole, fraction := s, ""
+    if i := strings.IndexByte(s, '.'); i >= 0 {
+        whole, fraction = s[:i], s[i+1:]
+        if fraction == "" {
+            return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+        }
+    }
+    if whole == "" || len(fraction) > int(decimals) || !isDigits(whole) || !isDigits(fraction) {
+        return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+    }
+
+    units, err := strconv.ParseUint(whole+fraction+strings.Repeat("0", int(decimals)-len(fraction)), 10, 64)
+    if err != nil {
+        return 0, fmt.Errorf("%w: %q", ErrAmountOverflow, s)
+    }
+
+    return Amount(units), nil
+}
+
+func isDigits(s string) bool {
+    for _, r := range s {
+        if r < '0' || r > '9' {
+            return false
+        }
+    }
+
+    return true
+}
+
+// Write a in c, e.g. "12.345 ART"
+func (c Currency) Format(a Amount) string {
+    return FormatAmount(a, c.Decimals) + " " + c.Ticker
+}
+
+// Read an amount of c like "12.345 ART"; the ticker may be left off
+func (c Currency) ParseAmount(s string) (Amount, error) {
+    fields := strings.Fields(s)
+    if len(fields) == 2 && fields[1] == c.Ticker {
+        fields = fields[:1]
+    }
+    if len(fields) != 1 {
+        return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+    }
+
+    return ParseAmount(fields[0], c.Decimals)
+}
@@ -0,0 +1,109 @@
+package account
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in			string
+		decimals	uint8
+		want		Amount
+		err			error
+	}{
+		{"0.1", 8, 10000000, nil},
+		{"12.345", 3, 12345, nil},
+		{"12.3", 3, 12300, nil},
+		{"007", 2, 700, nil},
+		{"0", 0, 0, nil},
+		{"18446744073709551615", 0, MaxAmount, nil},
+		{"184467440737.09551615", 8, MaxAmount, nil},
+		{"1.", 8, 0, ErrInvalidAmount},
+		{".5", 8, 0, ErrInvalidAmount},
+		{"", 8, 0, ErrInvalidAmount},
+		{"1.234", 2, 0, ErrInvalidAmount},
+		{"1.5", 0, 0, ErrInvalidAmount},
+		{"-1", 8, 0, ErrInvalidAmount},
+		{"+1", 8, 0, ErrInvalidAmount},
+		{"1e3", 8, 0, ErrInvalidAmount},
+		{"1.2.3", 8, 0, ErrInvalidAmount},
+		{"18446744073709551616", 0, 0, ErrAmountOverflow},
+		{"184467440737.09551616", 8, 0, ErrAmountOverflow},
+		{"1000000000000", 8, 0, ErrAmountOverflow},
+	}
+
+	for _, test := range tests {
+		got, err := ParseAmount(test.in, test.decimals)
+		if !errors.Is(err, test.err) || (test.err == nil && err != nil) || got != test.want {
+			t.Errorf("ParseAmount(%q, %d) = %d, %v; want %d, %v", test.in, test.decimals, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		in			Amount
+		decimals	uint8
+		want		string
+	}{
+		{0, 0, "0"},
+		{0, 8, "0"},
+		{10000000, 8, "0.1"},
+		{1, 8, "0.00000001"},
+		{12345, 3, "12.345"},
+		{12300, 3, "12.3"},
+		{100, 2, "1"},
+		{MaxAmount, 0, "18446744073709551615"},
+		{MaxAmount, 8, "184467440737.09551615"},
+		{MaxAmount, MaxDecimals, "18.446744073709551615"},
+	}
+
+	for _, test := range tests {
+		got := FormatAmount(test.in, test.decimals)
+		if got != test.want {
+			t.Errorf("FormatAmount(%d, %d) = %q, want %q", test.in, test.decimals, got, test.want)
+		}
+
+		back, err := ParseAmount(got, test.decimals)
+		if err != nil || back != test.in {
+			t.Errorf("ParseAmount(%q, %d) = %d, %v; want %d", got, test.decimals, back, err, test.in)
+		}
+	}
+}
+
+func TestCurrencyParseAmount(t *testing.T) {
+	art := NativeCurrency()
+
+	for _, in := range []string{"1.5 ART", "1.5"} {
+		if got, err := art.ParseAmount(in); err != nil || got != 150000000 {
+			t.Errorf("%q: %d, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"1.5 GLD", "1.5 ART extra", ""} {
+		if _, err := art.ParseAmount(in); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("%q: %v", in, err)
+		}
+	}
+	if got := art.Format(150000000); got != "1.5 ART" {
+		t.Error(got)
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	if sum, err := Amount(2).Add(3); err != nil || sum != 5 {
+		t.Error(sum, err)
+	}
+	if _, err := MaxAmount.Add(1); !errors.Is(err, ErrAmountOverflow) {
+		t.Error("MaxAmount + 1:", err)
+	}
+	if diff, err := Amount(5).Sub(5); err != nil || diff != 0 {
+		t.Error(diff, err)
+	}
+	if _, err := Amount(2).Sub(3); !errors.Is(err, ErrAmountOverflow) {
+		t.Error("2 - 3:", err)
+	}
+	if got := MaxAmount.addCapped(1); got != MaxAmount {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,247 @@
+package account
+
+import (
+    "time"
+
+    "github.com/thomasbeukema/dargent/store"
+)
+
+// Balance right before the tx at position i
+func (led *Ledger) balanceBefore(i int) Amount {
+    if i > len(led.TxList) {
+        i = len(led.TxList)
+    }
+
+    for i--; i >= 0; i-- {
+        switch led.TxList[i].Action {
+        case SEND, CLAIM, CREATE, MINT, BURN:
+            return led.TxList[i].Balance
+        }
+    }
+
+    return 0
+}
+
+// Check the balance change tx makes on its own chain, coming from before
+func checkTransition(tx Transaction, before Amount) bool {
+    switch tx.Action {
+    case SEND: // Can't send more than there is, or nothing at all
+        return tx.Balance < before
+    case CLAIM, MINT:
+        return tx.Balance > before
+    case BURN:
+        return tx.Balance < before
+    default: // Other txs don't move money
+        return tx.Balance == 0
+    }
+}
+
+// Check that tx moves the balance correctly when it follows TxList[prev]. For
+// a CLAIM the balance has to rise by exactly the amount of its SEND.
+func (led *Ledger) checkBalance(tx Transaction, prev int, acc *Account) error {
+    before := led.balanceBefore(prev + 1)
+
+    if !checkTransition(tx, before) {
+        return ErrInvalidBalance
+    }
+    if err := led.checkToken(tx, prev, acc); err != nil {
+        return err
+    }
+
+    if tx.Action == CLAIM {
+        amount, err := led.checkClaim(tx, acc)
+        if err != nil {
+            return err
+        }
+        if after, err := before.Add(amount); err != nil || tx.Balance != after {
+            return ErrInvalidBalance
+        }
+    }
+
+    return nil
+}
+
+// Check the SEND a CLAIM collects: it has to be pending for acc, which also
+// means it exists and isn't claimed yet, and acc has to trust its issuer.
+// Returns the amount which was sent.
+func (led *Ledger) checkClaim(claim Transaction, acc *Account) (Amount, error) {
+    send, ok, err := findPending(acc.store, acc.Address, claim.Origin)
+    if err != nil {
+        return 0, err
+    }
+    if !ok || send.Currency != claim.Currency {
+        return 0, ErrInvalidClaim
+    }
+
+    trusted, err := led.trusts(claim.Currency, acc, time.Now())
+    if err != nil {
+        return 0, err
+    }
+    if !trusted {
+        return 0, ErrNotTrusted
+    }
+
+    for _, tx := range led.TxList { // Already claimed
+        if tx.Action == CLAIM && tx.Origin == claim.Origin {
+            return 0, ErrInvalidClaim
+        }
+    }
+
+    return send.Amount, nil
+}
+
+// Number of txs at the start of the chain whose CLAIMs each collect a known
+// SEND to addr in s, once and for the amount it sent, of a token addr trusted
+// at that point. For ledgers which didn't come through AddTransaction, e.g.
+// from a peer; txs from the first CLAIM of an unknown SEND on can't be
+// trusted until that SEND is known.
+func (led *Ledger) BackedLength(s store.Store, addr string) (int, error) {
+    claimed := make(map[string]bool)
+    holder := Account{Address: addr, store: s}
+
+    for i, tx := range led.TxList {
+        if tx.Action != CLAIM {
+            continue
+        }
+        if claimed[tx.Origin] {
+            return i, nil
+        }
+
+        var amount Amount
+        if p, ok, err := findPending(s, addr, tx.Origin); err != nil {
+            return 0, err
+        } else if ok {
+            if p.Currency != tx.Currency {
+                return i, nil
+            }
+            amount = p.Amount
+        } else { // Not pending, maybe because our copy claimed it already
+            claim, collected, ok, err := storedClaim(s, addr, tx.Currency.Ticker, tx.Origin)
+            if err != nil {
+                return 0, err
+            }
+            if !ok || claim.Currency != tx.Currency {
+                return i, nil
+            }
+            amount = collected
+        }
+
+        before := Ledger{TxList: led.TxList[:i]} // Only a TRUST before the CLAIM counts
+        if trusted, err := before.trusts(tx.Currency, &holder, time.Now()); err != nil {
+            return 0, err
+        } else if !trusted {
+            return i, nil
+        }
+
+        if after, err := led.balanceBefore(i).Add(amount); err != nil || tx.Balance != after {
+            return i, nil
+        }
+        claimed[tx.Origin] = true
+    }
+
+    return len(led.TxList), nil
+}
+
+// Find the CLAIM of the SEND hash in the stored ledger of currency of addr,
+// with the amount it collected; it was checked when it got there
+func storedClaim(s store.Store, addr string, currency string, hash string) (Transaction, Amount, bool, error) {
+    if !AccountExists(s, addr) {
+        return Transaction{}, 0, false, nil
+    }
+
+    acc, err := OpenAccount(s, addr, nil)
+    if err != nil {
+        return Transaction{}, 0, false, err
+    }
+    if !acc.HasLedger(currency) {
+        return Transaction{}, 0, false, nil
+    }
+
+    led, err := acc.OpenLedger(currency)
+    if err != nil {
+        return Transaction{}, 0, false, err
+    }
+
+    for i, tx := range led.TxList {
+        if tx.Action != CLAIM || tx.Origin != hash {
+            continue
+        }
+        amount, err := tx.Balance.Sub(led.balanceBefore(i))
+        if err != nil {
+            return Transaction{}, 0, false, nil
+        }
+        return tx, amount, true, nil
+    }
+
+    return Transaction{}, 0, false, nil
+}
+
+// Check tx against the currency of the ledger when it follows TxList[prev]:
+// it can't switch currencies, only the owner mints, burns and revokes, and
+// minting can't overflow the supply
+func (led *Ledger) checkToken(tx Transaction, prev int, acc *Account) error {
+    switch tx.Action {
+    case SEND, CLAIM, MINT, BURN, TRUST, REVOKE:
+        if len(led.TxList) > 0 && tx.Currency != led.TxList[0].Currency {
+            return ErrInvalidCurrency
+        }
+    }
+
+    switch tx.Action {
+    case MINT, BURN, REVOKE:
+        if acc.Address != tx.Currency.Owner {
+            return ErrNotOwner
+        }
+    }
+
+    if tx.Action == MINT || tx.Action == BURN { // The supply has to stay within an Amount
+        after := Ledger{TxList: append(led.TxList[:prev+1:prev+1], tx)}
+        if _, err := after.supplyBefore(prev + 2); err != nil {
+            if tx.Action == BURN { // Can't take more out of circulation than there is
+                return ErrSupplyMismatch
+            }
+            return ErrInvalidBalance
+        }
+    }
+
+    return nil
+}
+
+// Check the CREATE opening a ledger: the owner of a token issues its supply
+// and registers it, holders start from nothing with the registered token
+func checkCreate(tx Transaction, acc *Account) error {
+    if !checkCreateBalance(tx, acc) {
+        return ErrInvalidBalance
+    }
+
+    c := tx.Currency
+    if c.IsNative() {
+        return nil
+    }
+    if c.Owner == acc.Address {
+        return checkCurrencyAvailable(acc.store, c)
+    }
+
+    registered, err := LookupCurrency(acc.store, c.Ticker)
+    if err != nil {
+        return err
+    }
+    if registered != c {
+        return ErrInvalidCurrency
+    }
+
+    return nil
+}
+
+// Balance a CREATE of acc may start with: all ART for the genesis account,
+// the supply of a token for its owner, nothing otherwise
+func checkCreateBalance(tx Transaction, acc *Account) bool {
+    switch {
+    case tx.Currency.IsNative() && isGenesis(acc.Address):
+        return tx.Balance == NativeSupply
+    case tx.Currency.Owner == acc.Address:
+        return tx.Balance == tx.Currency.Supply
+    default:
+        return tx.Balance == 0
+    }
+}
@@ -0,0 +1,128 @@
+package account
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNativeCreateStartsEmpty(t *testing.T) {
+	f := newFixture(t)
+
+	kp := f.key()
+	acc := f.open(kp)
+	create, _ := NewCreateTransaction(kp.PublicKey, kp)
+	create.Balance = MaxAmount
+	create.Sign(kp)
+
+	if err := acc.AddTransaction(create); !errors.Is(err, ErrInvalidBalance) {
+		t.Fatalf("CREATE printing ART: got %v, want ErrInvalidBalance", err)
+	}
+
+	genesis, _ := NewGenesisTransaction(kp.PublicKey, kp)
+	if err := acc.AddTransaction(genesis); !errors.Is(err, ErrInvalidBalance) {
+		t.Fatalf("second genesis: got %v, want ErrInvalidBalance", err)
+	}
+}
+
+func TestVerifyChainChecksCreateBalance(t *testing.T) {
+	f := newFixture(t)
+	kp := f.key()
+	acc := f.open(kp)
+
+	create, _ := NewCreateTransaction(kp.PublicKey, kp)
+	create.Balance = 1000
+	create.Sign(kp)
+
+	led := Ledger{Currency: NativeCurrency().Ticker, TxList: []Transaction{create}}
+	led.CalculateHash()
+	if led.VerifyChain(&acc) {
+		t.Fatal("chain starting with 1000 ART verified")
+	}
+
+	genesis := f.open(f.genesis)
+	gled, _ := genesis.OpenLedger(NativeCurrency().Ticker)
+	if !gled.VerifyChain(&genesis) {
+		t.Fatal("genesis chain didn't verify")
+	}
+}
+
+func TestSendAndClaim(t *testing.T) {
+	f := newFixture(t)
+	ka, a := f.funded(100)
+	kb, b := f.account()
+
+	over, _ := NewSendTransaction(a.Address, f.last(a).Hash, b.Address, 100, NativeCurrency(), ka)
+	if err := a.AddTransaction(over); !errors.Is(err, ErrInvalidBalance) {
+		t.Fatalf("SEND of nothing: got %v, want ErrInvalidBalance", err)
+	}
+
+	send := f.send(ka, a, b, 60)
+
+	wrong, _ := NewClaimTransaction(b.Address, f.last(b).Hash, send.Hash, 61, NativeCurrency(), kb)
+	if err := b.AddTransaction(wrong); !errors.Is(err, ErrInvalidBalance) {
+		t.Fatalf("CLAIM of too much: got %v, want ErrInvalidBalance", err)
+	}
+
+	claim := f.claim(kb, b, send, 60)
+
+	again, _ := NewClaimTransaction(b.Address, claim.Hash, send.Hash, 120, NativeCurrency(), kb)
+	if err := b.AddTransaction(again); !errors.Is(err, ErrInvalidClaim) {
+		t.Fatalf("second CLAIM: got %v, want ErrInvalidClaim", err)
+	}
+
+	var total Amount
+	for _, acc := range []Account{f.open(f.genesis), a, b} {
+		led, _ := acc.OpenLedger(NativeCurrency().Ticker)
+		total += led.Balance()
+	}
+	if total != NativeSupply {
+		t.Fatalf("accounts hold %v, want %v", total, NativeSupply)
+	}
+}
+
+func TestBackedLength(t *testing.T) {
+	f := newFixture(t)
+	ka, a := f.funded(100)
+	kb, b := f.account()
+	send := f.send(ka, a, b, 40)
+
+	// Chain of b as a peer could send it, never checked by AddTransaction
+	led, _ := b.OpenLedger(NativeCurrency().Ticker)
+	claim, _ := NewClaimTransaction(b.Address, led.TxList[0].Hash, send.Hash, 40, NativeCurrency(), kb)
+	forged, _ := NewClaimTransaction(b.Address, claim.Hash, "0"+send.Hash[1:], 1000, NativeCurrency(), kb)
+	again, _ := NewClaimTransaction(b.Address, claim.Hash, send.Hash, 80, NativeCurrency(), kb)
+
+	for _, c := range []struct {
+		name	string
+		txs		[]Transaction
+		want	int
+	}{
+		{"known SEND", []Transaction{led.TxList[0], claim}, 2},
+		{"unknown SEND", []Transaction{led.TxList[0], claim, forged}, 2},
+		{"claimed twice", []Transaction{led.TxList[0], claim, again}, 2},
+	} {
+		chain := Ledger{Currency: led.Currency, TxList: c.txs}
+		got, err := chain.BackedLength(f.s, b.Address)
+		if err != nil || got != c.want {
+			t.Errorf("%s: got %d, %v; want %d", c.name, got, err, c.want)
+		}
+	}
+
+	wrong, _ := NewClaimTransaction(b.Address, led.TxList[0].Hash, send.Hash, 41, NativeCurrency(), kb)
+	chain := Ledger{Currency: led.Currency, TxList: []Transaction{led.TxList[0], wrong}}
+	if got, _ := chain.BackedLength(f.s, b.Address); got != 1 {
+		t.Errorf("wrong amount: got %d, want 1", got)
+	}
+}
+
+func TestBackedLengthAfterClaim(t *testing.T) {
+	f := newFixture(t)
+	ka, a := f.funded(100)
+	kb, b := f.account()
+	f.claim(kb, b, f.send(ka, a, b, 40), 40) // No longer pending, found in the ledger of a
+
+	led, _ := b.OpenLedger(NativeCurrency().Ticker)
+	if got, err := led.BackedLength(f.s, b.Address); err != nil || got != len(led.TxList) {
+		t.Fatalf("got %d, %v; want %d", got, err, len(led.TxList))
+	}
+}
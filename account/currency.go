@@ -1,14 +1,32 @@
 package account
 
+import (
+	"fmt"
+)
+
+// Most decimals a currency can have
+const MaxDecimals = 18
+
 type Currency struct {
-	Name	string			`json:"n"`
-	Ticker	string			`json:"t"`
-	Owner	string			`json:"o"`
+	Name		string			`json:"n"`
+	Ticker		string			`json:"t"`
+	Owner		string			`json:"o"`
+	Decimals	uint8			`json:"dc,omitempty"`	// Digits after the decimal point when displaying amounts
+	Supply		Amount			`json:"su,omitempty"`	// Issued by the CREATE of the owner
+	Mintable	bool			`json:"m,omitempty"`	// Whether the owner can MINT more than Supply
 }
 
-// Create new currency
-func NewCurrency(name, ticker, owner string) Currency {
-	return Currency{name, ticker, owner}
+// Create new currency; owner issues supply, and can mint more later when
+// mintable. Tokens are created on the ledger with NewCreateTokenTransaction.
+func NewCurrency(name, ticker, owner string, decimals uint8, supply Amount, mintable bool) Currency {
+	return Currency{
+		Name: name,
+		Ticker: ticker,
+		Owner: owner,
+		Decimals: decimals,
+		Supply: supply,
+		Mintable: mintable,
+	}
 }
 
 // Get name of currency
@@ -21,7 +39,43 @@ func (c *Currency) GetOwnerAddress() string {
 	return c.Owner
 }
 
+// Check whether c is the currency of the network rather than a token
+func (c Currency) IsNative() bool {
+	return c == NativeCurrency()
+}
+
+// Check the metadata of a token. Tickers are 1 to 12 uppercase letters or
+// digits, since they name ledgers in the store.
+func (c Currency) Validate() error {
+	if c.IsNative() {
+		return nil
+	}
+
+	if len(c.Ticker) == 0 || len(c.Ticker) > 12 || c.Ticker == NativeCurrency().Ticker {
+		return fmt.Errorf("%w: ticker %q", ErrInvalidCurrency, c.Ticker)
+	}
+	for _, r := range c.Ticker {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("%w: ticker %q", ErrInvalidCurrency, c.Ticker)
+		}
+	}
+	if c.Decimals > MaxDecimals {
+		return fmt.Errorf("%w: %d decimals", ErrInvalidCurrency, c.Decimals)
+	}
+	if c.Supply == 0 && !c.Mintable { // Could never hold anything
+		return fmt.Errorf("%w: no supply", ErrInvalidCurrency)
+	}
+	if !canonicalAddress(c.Owner) {
+		return fmt.Errorf("%w: owner %q", ErrInvalidCurrency, c.Owner)
+	}
+
+	return nil
+}
+
+// Digits after the point of ART; 1 ART is 100000000 units
+const NativeDecimals = 8
+
 // Return NativeCurrency 'ART'
 func NativeCurrency() Currency {
-	return Currency{"Argent", "ART", ""}
+	return Currency{Name: "Argent", Ticker: "ART", Decimals: NativeDecimals}
 }
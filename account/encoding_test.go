@@ -0,0 +1,137 @@
+package account
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// Test vectors from the doc comment of encoding.go; other implementations
+// check against the same values, so these may never change
+func goldenSend() Transaction {
+	return Transaction{
+		PreviousHash: "2ab",
+		Action: SEND,
+		Balance: 150000000,
+		Currency: NativeCurrency(),
+		Origin: "dar1a",
+		Destination: "dar1b",
+		Signature: "sig",
+		Work: 0x0102030405060708,
+	}
+}
+
+const (
+	goldenSendEncoding = "0100000000033261620000000008f0d18000000006417267656e" +
+		"7400000003415254000000000800000000000000000000000005" +
+		"646172316100000005646172316200000000"
+	goldenSendHash = "0b6c1c6a8b1ad9a923f5d69848efd296b453327cfe9865ea7713d4be5f13fd9bc"
+)
+
+func TestGoldenSend(t *testing.T) {
+	tx := goldenSend()
+
+	if got := hex.EncodeToString(tx.signingBytes()); got != goldenSendEncoding {
+		t.Fatalf("encoding\n got %s\nwant %s", got, goldenSendEncoding)
+	}
+	if got, err := tx.GenerateHash(); err != nil || got != goldenSendHash {
+		t.Fatalf("hash %s, %v", got, err)
+	}
+
+	wire, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(wire), goldenSendEncoding+"00000003736967"+"0102030405060708"; got != want {
+		t.Fatalf("wire\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestGoldenClaimAndTrust(t *testing.T) {
+	claim := Transaction{
+		PreviousHash: goldenSendHash,
+		Action: CLAIM,
+		Balance: 150000000,
+		Currency: NativeCurrency(),
+		Destination: "dar1b",
+	}
+	if got, _ := claim.GenerateHash(); got != "149faa7b4543cfebdfd2dd831b5fbc7decc93a8a569a2b9f34351faff574251bc" {
+		t.Fatalf("CLAIM hash %s", got)
+	}
+
+	trust := Transaction{
+		Action: TRUST,
+		Currency: Currency{Name: "Gold", Ticker: "GLD", Owner: "dar1o", Decimals: 2, Supply: 1000, Mintable: true},
+		Origin: "dar1a",
+		Destination: "dar1o",
+		Expiration: "1700000000000000000",
+	}
+	if got, _ := trust.GenerateHash(); got != "32544d79d02d56b687405c4a8ab7d067900cf0ec7cfe218f84f417850c2bece51" {
+		t.Fatalf("TRUST hash %s", got)
+	}
+}
+
+func TestUnmarshalGolden(t *testing.T) {
+	want := goldenSend()
+	wire, _ := want.MarshalBinary()
+
+	var tx Transaction
+	if err := tx.UnmarshalBinary(wire); err != nil {
+		t.Fatal(err)
+	}
+	want.Hash = goldenSendHash
+	if tx != want {
+		t.Fatalf("got %+v\nwant %+v", tx, want)
+	}
+
+	for name, b := range map[string][]byte{
+		"trailing byte": append(append([]byte{}, wire...), 0),
+		"short": wire[:len(wire)-1],
+		"empty": nil,
+		"other version": append([]byte{2}, wire[1:]...),
+	} {
+		if err := tx.UnmarshalBinary(b); !errors.Is(err, ErrBadEncoding) {
+			t.Errorf("%s: got %v, want ErrBadEncoding", name, err)
+		}
+	}
+
+	mintable := append([]byte{}, wire...) // Followed by origin, destination and expiration
+	mintable[len(goldenSendEncoding)/2-len("dar1a")-len("dar1b")-3*4-1] = 2
+	if err := tx.UnmarshalBinary(mintable); !errors.Is(err, ErrBadEncoding) {
+		t.Errorf("invalid boolean: got %v, want ErrBadEncoding", err)
+	}
+}
+
+func FuzzUnmarshalBinary(f *testing.F) {
+	fx := newFixture(f)
+	genesis := fx.last(fx.open(fx.genesis))
+	kp, acc := fx.funded(100)
+	send := fx.send(kp, acc, fx.open(fx.genesis), 40)
+	for _, tx := range []Transaction{genesis, send} {
+		b, err := tx.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+		f.Add(b[:len(b)-1])
+		f.Add(append(b, 0))
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var tx Transaction
+		if err := tx.UnmarshalBinary(b); err != nil {
+			return
+		}
+
+		// The encoding is canonical, whatever decodes encodes back the same
+		encoded, err := tx.MarshalBinary()
+		if err != nil || !bytes.Equal(encoded, b) {
+			t.Fatalf("decoded tx encodes to %x, %v", encoded, err)
+		}
+		if h, err := tx.GenerateHash(); err != nil || tx.Hash != h {
+			t.Fatalf("hash %s, want %s, %v", tx.Hash, h, err)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package account
+
+import (
+    "errors"
+
+    "github.com/thomasbeukema/dargent/address"
+)
+
+var (
+    ErrAccountNotFound = errors.New("Account not found")
+    ErrLedgerNotFound = errors.New("Ledger not found")
+    ErrCorruptAccount = errors.New("Account is corrupt")
+    ErrCorruptLedger = errors.New("Ledger is corrupt")
+    ErrInvalidTransaction = errors.New("Invalid transaction")
+    ErrDuplicateTransaction = errors.New("Transaction already in ledger")
+    ErrBrokenChain = errors.New("Transaction doesn't follow the last transaction of the ledger")
+    ErrFork = errors.New("Transaction conflicts with the ledger")
+    ErrInvalidBalance = errors.New("Transaction moves the balance incorrectly")
+    ErrInvalidClaim = errors.New("Claimed SEND isn't pending for the account")
+    ErrInvalidCurrency = errors.New("Invalid currency")
+    ErrCurrencyExists = errors.New("Ticker is taken by another currency")
+    ErrCurrencyNotFound = errors.New("Currency not found")
+    ErrNotOwner = errors.New("Only the owner of the currency can do this")
+    ErrSupplyMismatch = errors.New("Balances don't add up to the supply")
+    ErrNotTrusted = errors.New("Account doesn't trust the issuer of the currency")
+    ErrInvalidAmount = errors.New("Invalid amount")
+    ErrAmountOverflow = errors.New("Amount out of range")
+    ErrInvalidDifficulty = errors.New("Work difficulty out of range")
+    ErrInvalidGenesis = errors.New("Invalid genesis account")
+
+    // Shared with the address package, so errors.Is matches either
+    ErrInvalidSignature = address.ErrInvalidSignature
+    ErrBadEncoding = address.ErrBadEncoding
+)
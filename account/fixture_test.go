@@ -0,0 +1,220 @@
+package account
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/thomasbeukema/dargent/address"
+	"github.com/thomasbeukema/dargent/store"
+)
+
+func TestMain(m *testing.M) {
+	SetWorkDifficulty(0) // Work is tested on its own, see work_test.go
+	os.Exit(m.Run())
+}
+
+// Store with a genesis account holding all ART, from which accounts are funded
+type fixture struct {
+	t		testing.TB
+	s		store.Store
+	genesis	address.ECCKeyPair
+	keys	int // Keys handed out, so every account gets other entropy
+}
+
+func newFixture(t testing.TB) *fixture {
+	f := &fixture{t: t, s: store.NewMemoryStore()}
+
+	f.genesis = f.key()
+	if err := SetGenesisAccount(f.genesis.GetAddress()); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := NewGenesisTransaction(f.genesis.PublicKey, f.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.add(f.open(f.genesis), tx)
+
+	return f
+}
+
+// Deterministic key, different for every call
+func (f *fixture) key() address.ECCKeyPair {
+	f.keys++
+
+	entropy := make([]byte, 32)
+	entropy[0] = byte(f.keys)
+	kp, err := address.GenerateECCKeyPair(entropy)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return kp
+}
+
+func (f *fixture) open(kp address.ECCKeyPair) Account {
+	acc, err := OpenAccount(f.s, kp.GetAddress(), kp.PublicKey)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return acc
+}
+
+func (f *fixture) add(acc Account, tx Transaction) {
+	f.t.Helper()
+
+	if err := acc.AddTransaction(tx); err != nil {
+		f.t.Fatalf("adding %v: %v", tx.Action, err)
+	}
+}
+
+// Last tx of the native ledger of acc
+func (f *fixture) last(acc Account) Transaction {
+	led, err := acc.OpenLedger(NativeCurrency().Ticker)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return led.TxList[len(led.TxList)-1]
+}
+
+// New account with only its CREATE
+func (f *fixture) account() (address.ECCKeyPair, Account) {
+	kp := f.key()
+	acc := f.open(kp)
+
+	create, err := NewCreateTransaction(kp.PublicKey, kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(acc, create)
+
+	return kp, acc
+}
+
+// Send amount from the account of kp to acc; returns the SEND
+func (f *fixture) send(kp address.ECCKeyPair, from Account, to Account, amount Amount) Transaction {
+	f.t.Helper()
+
+	prev := f.last(from)
+	led, _ := from.OpenLedger(NativeCurrency().Ticker)
+	send, err := NewSendTransaction(from.Address, prev.Hash, to.Address, led.Balance()-amount, NativeCurrency(), kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(from, send)
+
+	return send
+}
+
+// Claim send for the account of kp
+func (f *fixture) claim(kp address.ECCKeyPair, acc Account, send Transaction, amount Amount) Transaction {
+	f.t.Helper()
+
+	prev := f.last(acc)
+	led, _ := acc.OpenLedger(NativeCurrency().Ticker)
+	claim, err := NewClaimTransaction(acc.Address, prev.Hash, send.Hash, led.Balance()+amount, NativeCurrency(), kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(acc, claim)
+
+	return claim
+}
+
+// New account holding amount ART, sent by the genesis account
+func (f *fixture) funded(amount Amount) (address.ECCKeyPair, Account) {
+	kp, acc := f.account()
+	send := f.send(f.genesis, f.open(f.genesis), acc, amount)
+	f.claim(kp, acc, send, amount)
+
+	return kp, acc
+}
+
+// Delegate the weight of the account of kp to itself
+func (f *fixture) delegate(kp address.ECCKeyPair, acc Account) Transaction {
+	f.t.Helper()
+
+	tx, err := NewDelegateTransaction(acc.Address, f.last(acc).Hash, acc.Address, kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(acc, tx)
+
+	return tx
+}
+
+// Last tx of the ledger of ticker of acc
+func (f *fixture) lastOf(acc Account, ticker string) Transaction {
+	led, err := acc.OpenLedger(ticker)
+	if err != nil || len(led.TxList) == 0 {
+		f.t.Fatal("no ledger of", ticker, err)
+	}
+
+	return led.TxList[len(led.TxList)-1]
+}
+
+// Issue a token owned by the account of kp
+func (f *fixture) token(kp address.ECCKeyPair, acc Account, ticker string, supply Amount, mintable bool) Currency {
+	f.t.Helper()
+
+	c := NewCurrency("Token "+ticker, ticker, acc.Address, 2, supply, mintable)
+	create, err := NewCreateTokenTransaction(base64Key(kp.PublicKey), c, supply, kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(acc, create)
+
+	return c
+}
+
+// New account with a ledger of c, trusting its owner
+func (f *fixture) holder(c Currency) (address.ECCKeyPair, Account) {
+	f.t.Helper()
+
+	kp, acc := f.account()
+	create, err := NewCreateTokenTransaction(base64Key(kp.PublicKey), c, 0, kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(acc, create)
+
+	trust, err := NewTrustTransaction(acc.Address, create.Hash, c, "", kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(acc, trust)
+
+	return kp, acc
+}
+
+// Send amount of c from the account of kp to acc; returns the SEND
+func (f *fixture) sendToken(kp address.ECCKeyPair, from Account, to Account, c Currency, amount Amount) Transaction {
+	f.t.Helper()
+
+	led, _ := from.OpenLedger(c.Ticker)
+	send, err := NewSendTransaction(from.Address, f.lastOf(from, c.Ticker).Hash, to.Address, led.Balance()-amount, c, kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.add(from, send)
+
+	return send
+}
+
+// Claim of send for the account of kp following its last tx of c; not added
+func (f *fixture) claimToken(kp address.ECCKeyPair, acc Account, send Transaction, amount Amount) Transaction {
+	led, _ := acc.OpenLedger(send.Currency.Ticker)
+	claim, err := NewClaimTransaction(acc.Address, f.lastOf(acc, send.Currency.Ticker).Hash, send.Hash, led.Balance()+amount, send.Currency, kp)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return claim
+}
+
+func base64Key(pubkey []byte) string {
+	return base64.StdEncoding.EncodeToString(pubkey)
+}
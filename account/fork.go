@@ -0,0 +1,144 @@
+package account
+
+// Two or more transactions claiming the same predecessor. Only one of them can
+// stay in the chain, the others would be a double spend.
+type Fork struct {
+    PreviousHash    string          `json:"p"`
+    Candidates      []Transaction   `json:"c"`              // All txs claiming PreviousHash, first seen first
+    Resolved        string          `json:"r,omitempty"`    // Hash of the candidate which won
+}
+
+// Check whether tx is one of the candidates of the fork
+func (f *Fork) hasCandidate(hash string) bool {
+    for _, c := range f.Candidates {
+        if c.Hash == hash {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Get the fork at previousHash, if there is one
+func (led *Ledger) ForkState(previousHash string) (Fork, bool) {
+    for _, f := range led.Forks {
+        if f.PreviousHash == previousHash {
+            return f, true
+        }
+    }
+
+    return Fork{}, false
+}
+
+// Position of the tx with this hash in the chain, -1 if it isn't in there
+func (led *Ledger) indexOf(hash string) int {
+    for i, tx := range led.TxList {
+        if tx.Hash == hash {
+            return i
+        }
+    }
+
+    return -1
+}
+
+// Put tx in quarantine together with the tx in the chain following TxList[i],
+// then decide which of them stays in the chain
+func (led *Ledger) quarantine(i int, tx Transaction, acc *Account) error {
+    prev := led.TxList[i].Hash
+
+    var f *Fork
+    for j := range led.Forks {
+        if led.Forks[j].PreviousHash == prev {
+            f = &led.Forks[j]
+        }
+    }
+    if f == nil {
+        led.Forks = append(led.Forks, Fork{
+            PreviousHash: prev,
+            Candidates: []Transaction{led.TxList[i+1]},
+        })
+        f = &led.Forks[len(led.Forks)-1]
+    }
+
+    if f.hasCandidate(tx.Hash) {
+        return nil
+    }
+    f.Candidates = append(f.Candidates, tx)
+
+    dropped := led.resolveFork(i, f, acc)
+    if err := led.Write(acc); err != nil {
+        return err
+    }
+
+    if len(dropped) == 0 {
+        return nil
+    }
+
+    for _, d := range dropped {
+        switch d.Action {
+        case SEND:
+            if err := removePending(acc.store, d.Destination, d.Hash); err != nil {
+                return err
+            }
+        case CLAIM: // Its SEND can be claimed again, unless the chain still claims it
+            if err := restorePending(acc.store, d); err != nil {
+                return err
+            }
+        }
+    }
+
+    return led.UpdatePending(acc)
+}
+
+// Pick the winner of a fork; every node has to come to the same conclusion.
+// A candidate confirmed by the representatives always stays. When the owner of
+// the account signed the ledger with the current candidate in it, the first
+// signed ledger wins. Otherwise the candidate with the lowest SHA-256 wins,
+// comparing the hex digest of the hash without the action in front of it, so
+// the type of a tx doesn't decide. Txs following the losing candidate in the
+// chain are dropped and returned.
+func (led *Ledger) resolveFork(i int, f *Fork, acc *Account) []Transaction {
+    current := led.TxList[i+1]
+
+    if led.IsConfirmed(current.Hash) {
+        f.Resolved = current.Hash
+        return nil
+    }
+
+    if led.Signature != "" && led.verifySignature(led.Signature, acc) == nil {
+        f.Resolved = current.Hash
+        return nil
+    }
+
+    winner := f.Candidates[0]
+    for _, c := range f.Candidates[1:] {
+        if hashDigest(c.Hash) < hashDigest(winner.Hash) {
+            winner = c
+        }
+    }
+    f.Resolved = winner.Hash
+
+    if winner.Hash == current.Hash {
+        return nil
+    }
+
+    dropped := append([]Transaction{}, led.TxList[i+1:]...)
+
+    led.TxList = append(led.TxList[:i+1:i+1], winner)
+    if led.journaled > i+1 {
+        led.journaled = i + 1
+    }
+    led.Signature = "" // Signed a different chain
+    led.CalculateHash()
+
+    return dropped
+}
+
+// The SHA-256 part of a tx hash, which is the action followed by 64 hex digits
+func hashDigest(hash string) string {
+    if len(hash) < 64 {
+        return hash
+    }
+
+    return hash[len(hash)-64:]
+}
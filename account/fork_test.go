@@ -0,0 +1,163 @@
+package account
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/thomasbeukema/dargent/address"
+)
+
+// Two SENDs of the account of kp following the same tx, to b and c
+func conflictingSends(t *testing.T, kp address.ECCKeyPair, acc Account, b, c Account) (Transaction, Transaction) {
+	led, _ := acc.OpenLedger(NativeCurrency().Ticker)
+	prev := led.TxList[len(led.TxList)-1].Hash
+
+	s1, err := NewSendTransaction(acc.Address, prev, b.Address, led.Balance()-10, NativeCurrency(), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := NewSendTransaction(acc.Address, prev, c.Address, led.Balance()-20, NativeCurrency(), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s1, s2
+}
+
+// Whichever SEND arrives first, every node ends up with the one with the
+// lowest digest, and only its destination can claim it
+func TestForkLowestDigestWins(t *testing.T) {
+	var winners []string
+
+	for _, reversed := range []bool{false, true} {
+		f := newFixture(t)
+		kp, acc := f.funded(100)
+		_, b := f.account()
+		_, c := f.account()
+		s1, s2 := conflictingSends(t, kp, acc, b, c)
+
+		first, second := s1, s2
+		if reversed {
+			first, second = s2, s1
+		}
+		f.add(acc, first)
+		if err := acc.AddTransaction(second); !errors.Is(err, ErrFork) {
+			t.Fatalf("conflicting SEND: got %v, want ErrFork", err)
+		}
+		if err := acc.AddTransaction(second); !errors.Is(err, ErrDuplicateTransaction) {
+			t.Fatalf("candidate added twice: %v", err)
+		}
+
+		win, lose := s1, s2
+		if hashDigest(s2.Hash) < hashDigest(s1.Hash) {
+			win, lose = s2, s1
+		}
+
+		led, _ := acc.OpenLedger(NativeCurrency().Ticker)
+		fork, ok := led.ForkState(s1.PreviousHash)
+		if !ok || len(fork.Candidates) != 2 || fork.Resolved != win.Hash {
+			t.Fatalf("fork %+v, want %s resolved", fork, win.Hash)
+		}
+		if led.TxList[len(led.TxList)-1].Hash != win.Hash || led.Contains(lose.Hash) {
+			t.Fatal("losing SEND in the chain")
+		}
+		if !led.VerifyChain(&acc) {
+			t.Fatal("chain after fork doesn't verify")
+		}
+
+		if _, ok, _ := findPending(f.s, win.Destination, win.Hash); !ok {
+			t.Error("winning SEND not pending")
+		}
+		if _, ok, _ := findPending(f.s, lose.Destination, lose.Hash); ok {
+			t.Error("losing SEND still pending")
+		}
+
+		winners = append(winners, win.Hash)
+	}
+
+	if winners[0] != winners[1] {
+		t.Fatal("winner depends on the order txs arrive in")
+	}
+}
+
+func TestForkKeepsConfirmed(t *testing.T) {
+	f := newFixture(t)
+	kp, acc := f.funded(100)
+	_, b := f.account()
+	_, c := f.account()
+	s1, s2 := conflictingSends(t, kp, acc, b, c)
+
+	// The one which would lose on its digest got confirmed first
+	current, other := s1, s2
+	if hashDigest(s1.Hash) < hashDigest(s2.Hash) {
+		current, other = s2, s1
+	}
+	f.add(acc, current)
+	led, _ := acc.OpenLedger(NativeCurrency().Ticker)
+	if !led.confirm(current.Hash, &acc) {
+		t.Fatal("confirming")
+	}
+
+	if err := acc.AddTransaction(other); !errors.Is(err, ErrFork) {
+		t.Fatalf("got %v, want ErrFork", err)
+	}
+	led, _ = acc.OpenLedger(NativeCurrency().Ticker)
+	if fork, _ := led.ForkState(current.PreviousHash); fork.Resolved != current.Hash || !led.Contains(current.Hash) {
+		t.Fatal("confirmed SEND dropped")
+	}
+}
+
+// A CLAIM losing a fork gives its SEND back to the pending index, so it can be
+// claimed again
+func TestForkDroppedClaimRestoresPending(t *testing.T) {
+	f := newFixture(t)
+	kp, acc := f.account()
+	create := f.last(acc)
+	send := f.send(f.genesis, f.open(f.genesis), acc, 25)
+	claim := f.claim(kp, acc, send, 25)
+
+	var rival Transaction // Conflicts with the CLAIM and wins
+	for {
+		rep := f.key()
+		tx, err := NewDelegateTransaction(acc.Address, create.Hash, rep.GetAddress(), kp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashDigest(tx.Hash) < hashDigest(claim.Hash) {
+			rival = tx
+			break
+		}
+	}
+
+	if err := acc.AddTransaction(rival); !errors.Is(err, ErrFork) {
+		t.Fatalf("got %v, want ErrFork", err)
+	}
+
+	led, _ := acc.OpenLedger(NativeCurrency().Ticker)
+	if led.Contains(claim.Hash) || !led.Contains(rival.Hash) {
+		t.Fatal("CLAIM not dropped")
+	}
+
+	p, ok, err := findPending(f.s, acc.Address, send.Hash)
+	if err != nil || !ok || p.Amount != 25 {
+		t.Fatalf("SEND of dropped CLAIM pending: %+v, %v, %v", p, ok, err)
+	}
+
+	again, err := NewClaimTransaction(acc.Address, rival.Hash, send.Hash, 25, NativeCurrency(), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.add(acc, again)
+}
+
+func TestHashDigestIgnoresAction(t *testing.T) {
+	digest := "00000000000000000000000000000000000000000000000000000000000000ff"
+	if hashDigest("1"+digest) != digest {
+		t.Fatal(hashDigest("1" + digest))
+	}
+
+	// A CLAIM (1) with a lower digest beats a SEND (0)
+	if !(hashDigest("1"+digest) < hashDigest("0f"+digest[1:])) {
+		t.Fatal("action prefix decided")
+	}
+}
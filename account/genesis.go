@@ -0,0 +1,58 @@
+package account
+
+import (
+    "fmt"
+    "sync"
+
+    "github.com/thomasbeukema/dargent/address"
+)
+
+// ART comes into existence once: the CREATE of the genesis account issues
+// NativeSupply, every other account starts with nothing and gets ART through
+// SENDs. Like the work difficulty, every node of a network has to use the
+// same genesis account.
+const NativeSupply Amount = 21000000 * 100000000 // 21 million ART
+
+// No account can start with ART until the genesis account is set
+var (
+    genesisAccount string
+    genesisMu sync.RWMutex
+)
+
+// Set the genesis account of the current network, so after SetNetwork
+func SetGenesisAccount(addr string) error {
+    normalized, err := address.Normalize(addr)
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrInvalidGenesis, err)
+    }
+
+    genesisMu.Lock()
+    defer genesisMu.Unlock()
+    genesisAccount = normalized
+
+    return nil
+}
+
+func GenesisAccount() string {
+    genesisMu.RLock()
+    defer genesisMu.RUnlock()
+
+    return genesisAccount
+}
+
+// Check whether addr is the genesis account
+func isGenesis(addr string) bool {
+    genesis := GenesisAccount()
+    return genesis != "" && addr == genesis
+}
+
+// Create the ledger of the genesis account, issuing all ART
+func NewGenesisTransaction(pubkey []byte, signer address.Signer) (Transaction, error) {
+    tx, err := NewCreateTransaction(pubkey, signer)
+    if err != nil {
+        return Transaction{}, err
+    }
+    tx.Balance = NativeSupply
+
+    return tx, tx.Sign(signer)
+}
@@ -0,0 +1,204 @@
+package account
+
+import (
+    "encoding/binary"
+    "errors"
+    "encoding/json"
+    "fmt"
+    "hash/crc32"
+
+    "github.com/thomasbeukema/dargent/store"
+)
+
+// Every tx which ends up in a ledger is first appended to the journal of the
+// ledger, so a ledger whose index got lost or corrupted can be rebuilt.
+// Records are: length (4 bytes) | crc32 of the entry (4 bytes) | JSON entry
+const journalHeaderSize = 8
+
+// Tx placed at Position in TxList; everything from Position on is replaced,
+// which also covers forks rolling back part of the chain
+type journalEntry struct {
+    Position    int         `json:"p"`
+    Tx          Transaction `json:"t"`
+}
+
+func journalKey(addr string, currency string) string {
+    return store.Key(addr, currency, "journal")
+}
+
+// Append every tx which isn't in the journal yet
+func (led *Ledger) journal(acc *Account) error {
+    if led.journaled > len(led.TxList) {
+        led.journaled = len(led.TxList)
+    }
+
+    records := make([]byte, 0)
+    for i := led.journaled; i < len(led.TxList); i++ {
+        entry, err := json.Marshal(journalEntry{i, led.TxList[i]})
+        if err != nil {
+            return err
+        }
+
+        header := make([]byte, journalHeaderSize)
+        binary.BigEndian.PutUint32(header[0:4], uint32(len(entry)))
+        binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(entry))
+
+        records = append(append(records, header...), entry...)
+    }
+
+    if len(records) == 0 {
+        return nil
+    }
+
+    if err := acc.store.Append(journalKey(acc.Address, led.Currency), records); err != nil {
+        return err
+    }
+
+    led.journaled = len(led.TxList)
+    return nil
+}
+
+// Apply the journal on top of txs. Stops at a torn record at the end, or at an
+// entry which doesn't connect to what came before.
+func replayJournal(raw []byte, txs []Transaction) []Transaction {
+    txs = append([]Transaction{}, txs...)
+
+    for len(raw) >= journalHeaderSize {
+        length := binary.BigEndian.Uint32(raw[0:4])
+        if uint64(length) > uint64(len(raw)-journalHeaderSize) {
+            break
+        }
+
+        entry := raw[journalHeaderSize : journalHeaderSize+int(length)]
+        if crc32.ChecksumIEEE(entry) != binary.BigEndian.Uint32(raw[4:8]) {
+            break
+        }
+
+        var e journalEntry
+        if err := json.Unmarshal(entry, &e); err != nil || e.Position < 0 || e.Position > len(txs) {
+            break
+        }
+
+        txs = append(txs[:e.Position], e.Tx)
+        raw = raw[journalHeaderSize+int(length):]
+    }
+
+    return txs
+}
+
+// Rebuild the ledger of currency from its journal, starting from what's still
+// readable in the index. Whatever the index holds that's still valid for the
+// rebuilt chain, like its signature, is kept.
+func (acc *Account) RecoverLedger(currency string) (Ledger, error) {
+    var old Ledger
+    readable := readGzipJSON(acc.store, ledgerKey(acc.Address, currency), &old) == nil
+
+    raw, err := acc.store.Get(journalKey(acc.Address, currency))
+    if err == store.ErrNotFound {
+        raw = nil
+    } else if err != nil {
+        return Ledger{}, err
+    }
+
+    base := make([]Transaction, 0)
+    if readable {
+        base = old.TxList
+    }
+
+    led := Ledger{
+        Currency: currency,
+        TxList: replayJournal(raw, base),
+    }
+    led.CalculateHash()
+    led.journaled = len(led.TxList)
+
+    if readable && old.Hash == led.Hash { // Nothing to repair
+        old.journaled = len(old.TxList)
+        return old, nil
+    }
+
+    if !readable && len(led.TxList) == 0 {
+        return Ledger{}, fmt.Errorf("%w: no journal to recover from", ErrCorruptLedger)
+    }
+
+    if readable {
+        led.Forks = old.Forks
+        if led.indexOf(old.Confirmed) >= 0 {
+            led.Confirmed = old.Confirmed
+        }
+        if old.Signature != "" && led.verifySignature(old.Signature, acc) == nil {
+            led.Signature = old.Signature
+        }
+    }
+
+    if err := writeGzipJSON(acc.store, ledgerKey(acc.Address, currency), led); err != nil {
+        return Ledger{}, err
+    }
+
+    return led, nil
+}
+
+// Replay the journal of every ledger in the store, repairing ledgers whose
+// index is corrupt or behind their journal, and bring the pending index in
+// line with the ledgers, which a crash right after writing a ledger leaves
+// behind; accounts stored under a legacy address are moved first. Finally the
+// balances of every token have to add up to its supply, see VerifySupply.
+// Returns the ledgers which were repaired as <address>/<currency>.
+func Recover(s store.Store) ([]string, error) {
+    repaired := make([]string, 0)
+
+    if err := migrateLegacyAccounts(s); err != nil {
+        return repaired, err
+    }
+
+    addrs, err := ListAccounts(s)
+    if err != nil {
+        return repaired, err
+    }
+
+    for _, addr := range addrs {
+        acc, err := OpenAccount(s, addr, nil)
+        if err != nil {
+            return repaired, err
+        }
+
+        currencies, err := acc.Ledgers()
+        if err != nil {
+            return repaired, err
+        }
+
+        for _, currency := range currencies {
+            var before Ledger
+            readable := readGzipJSON(s, ledgerKey(addr, currency), &before) == nil
+
+            led, err := acc.RecoverLedger(currency)
+            if err != nil {
+                return repaired, err
+            }
+
+            if !readable || led.Hash != before.Hash {
+                repaired = append(repaired, store.Key(addr, currency))
+            }
+
+            if err := led.UpdatePending(&acc); err != nil {
+                return repaired, err
+            }
+        }
+    }
+
+    tokens, err := ListCurrencies(s)
+    if err != nil {
+        return repaired, err
+    }
+    for _, c := range tokens {
+        err := VerifySupply(s, c.Ticker)
+        if errors.Is(err, ErrAccountNotFound) || errors.Is(err, ErrLedgerNotFound) { // Registered right before a crash
+            continue
+        }
+        if err != nil {
+            return repaired, err
+        }
+    }
+
+    return repaired, nil
+}
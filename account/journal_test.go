@@ -0,0 +1,162 @@
+package account
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// Journal record placing tx at position, see journal.go
+func journalRecord(t *testing.T, position int, tx Transaction) []byte {
+	entry, err := json.Marshal(journalEntry{position, tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]byte, journalHeaderSize)
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(entry)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(entry))
+
+	return append(header, entry...)
+}
+
+func hashes(txs []Transaction) []string {
+	list := make([]string, len(txs))
+	for i, tx := range txs {
+		list[i] = tx.Hash
+	}
+
+	return list
+}
+
+func TestReplayJournal(t *testing.T) {
+	txs := []Transaction{{Hash: "a"}, {Hash: "b"}, {Hash: "c"}, {Hash: "d"}}
+	var raw []byte
+	for i, tx := range txs[:3] {
+		raw = append(raw, journalRecord(t, i, tx)...)
+	}
+	rollback := journalRecord(t, 1, txs[3]) // A fork replaced b and c by d
+
+	badCRC := journalRecord(t, 3, txs[3])
+	badCRC[4] ^= 0xff
+
+	for _, c := range []struct {
+		name	string
+		base	[]Transaction
+		raw		[]byte
+		want	string
+	}{
+		{"all", nil, raw, "abc"},
+		{"on top of the index", txs[:2], journalRecord(t, 2, txs[2]), "abc"},
+		{"rollback", nil, append(append([]byte{}, raw...), rollback...), "ad"},
+		{"torn record", nil, append(append([]byte{}, raw...), rollback[:len(rollback)-1]...), "abc"},
+		{"torn header", nil, append(append([]byte{}, raw...), rollback[:3]...), "abc"},
+		{"bad checksum", nil, append(append([]byte{}, raw...), badCRC...), "abc"},
+		{"gap", nil, append(journalRecord(t, 0, txs[0]), journalRecord(t, 2, txs[2])...), "a"},
+	} {
+		got := ""
+		for _, h := range hashes(replayJournal(c.raw, c.base)) {
+			got += h
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRecoverLedgerFromCorruptIndex(t *testing.T) {
+	f := newFixture(t)
+	kp, acc := f.funded(100)
+	_, other := f.account()
+	f.send(kp, acc, other, 10)
+	want, _ := acc.OpenLedger(NativeCurrency().Ticker)
+
+	f.s.Put(ledgerKey(acc.Address, NativeCurrency().Ticker), []byte("not gzip"))
+
+	got, err := acc.OpenLedger(NativeCurrency().Ticker) // Rebuilt on opening
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != want.Hash || !got.VerifyChain(&acc) {
+		t.Fatal("ledger not rebuilt from the journal")
+	}
+
+	f.s.Delete(journalKey(acc.Address, NativeCurrency().Ticker))
+	f.s.Put(ledgerKey(acc.Address, NativeCurrency().Ticker), []byte("not gzip"))
+	if _, err := acc.RecoverLedger(NativeCurrency().Ticker); !errors.Is(err, ErrCorruptLedger) {
+		t.Fatalf("without journal: got %v, want ErrCorruptLedger", err)
+	}
+}
+
+// A crash after appending to the journal but before writing the index
+func TestRecoverIndexBehindJournal(t *testing.T) {
+	f := newFixture(t)
+	kp, acc := f.funded(100)
+	_, other := f.account()
+	old, _ := acc.OpenLedger(NativeCurrency().Ticker)
+	f.send(kp, acc, other, 10)
+	want, _ := acc.OpenLedger(NativeCurrency().Ticker)
+
+	writeGzipJSON(f.s, ledgerKey(acc.Address, NativeCurrency().Ticker), old)
+
+	repaired, err := Recover(f.s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repaired) != 1 || repaired[0] != acc.Address+"/"+NativeCurrency().Ticker {
+		t.Fatal(repaired)
+	}
+	if got, _ := acc.OpenLedger(NativeCurrency().Ticker); got.Hash != want.Hash {
+		t.Fatal("index not brought up to the journal")
+	}
+}
+
+// The journal of a ledger which switched to another fork candidate rebuilds
+// the chain the fork ended with
+func TestRecoverAfterFork(t *testing.T) {
+	f := newFixture(t)
+	kp, acc := f.funded(100)
+	_, b := f.account()
+	_, c := f.account()
+	s1, s2 := conflictingSends(t, kp, acc, b, c)
+
+	first, second := s1, s2 // The winner comes second, so the chain switches
+	if hashDigest(s1.Hash) < hashDigest(s2.Hash) {
+		first, second = s2, s1
+	}
+	f.add(acc, first)
+	acc.AddTransaction(second)
+	want, _ := acc.OpenLedger(NativeCurrency().Ticker)
+	if !want.Contains(second.Hash) {
+		t.Fatal("chain didn't switch")
+	}
+
+	f.s.Put(ledgerKey(acc.Address, NativeCurrency().Ticker), nil)
+	got, err := acc.RecoverLedger(NativeCurrency().Ticker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != want.Hash || got.Contains(first.Hash) {
+		t.Fatalf("recovered %v, want %v", hashes(got.TxList), hashes(want.TxList))
+	}
+}
+
+// A crash between writing a SEND to the ledger and to the pending index
+func TestRecoverRebuildsPending(t *testing.T) {
+	f := newFixture(t)
+	ka, a := f.funded(100)
+	kb, b := f.account()
+	send := f.send(ka, a, b, 30)
+
+	f.s.Delete(pendingKey(b.Address))
+
+	if _, err := Recover(f.s); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok, err := findPending(f.s, b.Address, send.Hash); err != nil || !ok || p.Amount != 30 {
+		t.Fatalf("pending %+v, %v, %v", p, ok, err)
+	}
+	f.claim(kb, b, send, 30)
+}
@@ -1,15 +1,11 @@
 package account
 
 import (
-    "encoding/json"
     "bytes"
-    "compress/gzip"
-    "io/ioutil"
-    "path/filepath"
     "encoding/base64"
     "crypto/sha256"
-
-    "github.com/thomasbeukema/dargent/address"
+    "fmt"
+    "hash"
 )
 
 type Ledger struct {
@@ -17,95 +13,245 @@ type Ledger struct {
     Hash        string
     TxList      []Transaction
     Signature   string
+    Forks       []Fork  `json:",omitempty"` // Conflicting txs seen for this ledger
+    Confirmed   string  `json:",omitempty"` // Hash of the last tx confirmed by the representatives
+    journaled   int     // Number of txs at the start of TxList already in the journal
 }
 
-func (led *Ledger) Write(acc *Account) {
-    ledgerJson, err := json.Marshal(*led)
-    if err != nil {
-        // TODO
-        panic(err)
+// Append new txs to the journal, then replace the stored ledger; the currency
+// is added to acc when the ledger holds its first tx
+func (led *Ledger) Write(acc *Account) error {
+    if err := led.registerCurrency(acc); err != nil {
+        return err
+    }
+    if err := led.journal(acc); err != nil {
+        return err
+    }
+
+    if err := writeGzipJSON(acc.store, ledgerKey(acc.Address, led.Currency), *led); err != nil {
+        return err
+    }
+    if len(led.TxList) == 0 {
+        return nil
     }
 
-    var gzipped bytes.Buffer
-    gzipper := gzip.NewWriter(&gzipped)
-    gzipper.Write(ledgerJson)
-    gzipper.Close()
+    return acc.addCurrency(led.Currency)
+}
 
-    ledgerPath := acc.getLedgerPath(led.Currency)
+// Check whether the ledger already holds a tx with this hash
+func (led *Ledger) Contains(hash string) bool {
+    for _, tx := range led.TxList {
+        if tx.Hash == hash {
+            return true
+        }
+    }
 
-    ioutil.WriteFile(filepath.Join(ledgerPath, "index.json.gz"), []byte(gzipped.String()), 0644)
+    return false
 }
 
-func (led *Ledger) addTransaction(tx Transaction, acc *Account) bool {
+func (led *Ledger) addTransaction(tx Transaction, acc *Account) error {
+    if led.Contains(tx.Hash) { // Seen it before, don't add it twice
+        return ErrDuplicateTransaction
+    }
+    if f, ok := led.ForkState(tx.PreviousHash); ok && f.hasCandidate(tx.Hash) {
+        return ErrDuplicateTransaction
+    }
+
+    v, err := acc.Verifier()
+    if err != nil {
+        return err
+    }
+
     if len(led.TxList) == 0 { // 'CREATE' tx
 
-        if tx.Action != CREATE {
-            return false
+        if tx.Action != CREATE { // Its CREATE isn't here (yet)
+            return ErrBrokenChain
         }
 
         decodedOrigin, err := base64.StdEncoding.DecodeString(tx.Origin)
         if err != nil {
-            // TODO: Proper err handling
-            panic(err)
+            return fmt.Errorf("%w: %v", ErrBadEncoding, err)
         }
 
-        if bytes.Equal(acc.PublicKey, decodedOrigin) {
-            led.TxList = append(led.TxList, tx)
-            led.CalculateHash()
-            led.Write(acc)
+        if !bytes.Equal(acc.PublicKey, decodedOrigin) || !tx.Verify(v) {
+            return ErrInvalidTransaction
         }
-    } else { // SEND, CLAIM, TRUST
-        if tx.Verify() {
-            led.TxList = append(led.TxList, tx)
-            led.CalculateHash()
-            led.Write(acc)
+        if err := checkCreate(tx, acc); err != nil {
+            return err
+        }
+    } else { // SEND, CLAIM, TRUST, DELEGATE, MINT, BURN, REVOKE
+        if !tx.Verify(v) {
+            return ErrInvalidTransaction
         }
-    }
 
-    return true
-}
+        if tx.PreviousHash != led.TxList[len(led.TxList)-1].Hash {
+            i := led.indexOf(tx.PreviousHash)
+            if i < 0 {
+                return ErrBrokenChain
+            }
+            if err := led.checkBalance(tx, i, acc); err != nil {
+                return err
+            }
 
-func (led *Ledger) CalculateHash() string {
-    hashes := ""
+            // Predecessor already has a successor: fork
+            if err := led.quarantine(i, tx, acc); err != nil {
+                return err
+            }
+            return ErrFork
+        }
 
-    for _, tx := range led.TxList {
-        hashes = hashes + ":" + tx.Hash
+        if err := led.checkBalance(tx, len(led.TxList)-1, acc); err != nil {
+            return err
+        }
     }
 
-    firstHash := sha256.Sum256([]byte(hashes))
-    finalHash := sha256.Sum256(firstHash[:])
+    before := led.Balance()
+    sent, _ := before.Sub(tx.Balance) // Only used for SENDs, which lower the balance
 
-    led.Hash = base64.StdEncoding.EncodeToString(finalHash[:])
+    led.TxList = append(led.TxList, tx)
+    led.CalculateHash()
+    if err := led.Write(acc); err != nil {
+        return err
+    }
 
-    return led.Hash
+    // Keep the index of unclaimed SENDs up to date. The tx is in the ledger
+    // at this point; when this fails Recover brings the index back.
+    switch tx.Action {
+    case SEND:
+        return addPending(acc.store, tx, sent)
+    case CLAIM:
+        return removePending(acc.store, acc.Address, tx.Origin)
+    }
+
+    return nil
 }
 
-func (led *Ledger) UpdateSignature(signature string, acc *Account) bool {
-    b64DecPubKey, err := base64.StdEncoding.DecodeString(led.TxList[0].Origin)
+// Check the whole chain: the first tx has to create acc with the balance it
+// may start with, see checkCreateBalance, every tx has to be
+// valid and signed by acc, follow the one before it and move the balance the right way,
+// token txs have to keep to the rules of their currency, and led.Hash has to
+// match the transactions. CLAIMs aren't matched against their SEND here, since
+// the sending account might not be known yet.
+func (led *Ledger) VerifyChain(acc *Account) bool {
+    if len(led.TxList) == 0 || led.TxList[0].Action != CREATE {
+        return false
+    }
+
+    v, err := acc.Verifier()
     if err != nil {
         return false
     }
-    switch len(signature) {
-    case 88: // ECDSA
-        if address.ValidateECCSignature(signature, []byte(led.Hash), b64DecPubKey) {
-            led.Signature = signature
-            led.Write(acc)
-        } else {
+
+    decodedOrigin, err := base64.StdEncoding.DecodeString(led.TxList[0].Origin)
+    if err != nil || !bytes.Equal(acc.PublicKey, decodedOrigin) || !led.TxList[0].Verify(v) {
+        return false
+    }
+    if !checkCreateBalance(led.TxList[0], acc) {
+        return false
+    }
+
+    for i, tx := range led.TxList[1:] {
+        if !tx.Verify(v) || tx.PreviousHash != led.TxList[i].Hash {
             return false
         }
-    case 54668: // SPHINCS
-    var sphincsPubKey [1056]byte
+        if !checkTransition(tx, led.balanceBefore(i+1)) || led.checkToken(tx, i, acc) != nil {
+            return false
+        }
+    }
+
+    check := Ledger{TxList: led.TxList}
+    return check.CalculateHash() == led.Hash
+}
+
+// Hash of the ledger: the double SHA-256 of the tx hashes, each preceded by a
+// colon
+func (led *Ledger) CalculateHash() string {
+    h := sha256.New()
+    for _, tx := range led.TxList {
+        h.Write([]byte(":" + tx.Hash))
+    }
+
+    led.Hash = finishHash(h)
+
+    return led.Hash
+}
+
+// Number of txs after which the ledger had hash, -1 if it never did. The
+// hash of every prefix comes from feeding the txs once.
+func (led *Ledger) OffsetOf(hash string) int {
+    h := sha256.New()
+    for i, tx := range led.TxList {
+        h.Write([]byte(":" + tx.Hash))
+        if finishHash(h) == hash {
+            return i + 1
+        }
+    }
+
+    return -1
+}
+
+// Second round of the ledger hash over what h holds, leaving h as it is
+func finishHash(h hash.Hash) string {
+    finalHash := sha256.Sum256(h.Sum(nil))
+    return base64.StdEncoding.EncodeToString(finalHash[:])
+}
 
-    for i := range b64DecPubKey {
-        sphincsPubKey[i] = b64DecPubKey[i]
+// Set signature of the ledger if it's valid for the current hash
+func (led *Ledger) UpdateSignature(signature string, acc *Account) error {
+    if err := led.verifySignature(signature, acc); err != nil {
+        return err
     }
 
-    if address.ValidateSPHINCSSignature(signature, []byte(led.Hash), &sphincsPubKey) {
-        led.Signature = signature
-        led.Write(acc)
-    } else {
+    led.Signature = signature
+
+    return led.Write(acc)
+}
+
+// Check signature of the current hash against the key of acc
+func (led *Ledger) verifySignature(signature string, acc *Account) error {
+    v, err := acc.Verifier()
+    if err != nil {
+        return err
+    }
+
+    return v.Verify(signature, []byte(led.Hash))
+}
+
+// Balance after the last tx which changed it
+func (led *Ledger) Balance() Amount {
+    return led.balanceBefore(len(led.TxList))
+}
+
+// Representative the account currently delegates its weight to
+func (led *Ledger) Representative() string {
+    for i := len(led.TxList) - 1; i >= 0; i-- {
+        if led.TxList[i].Action == DELEGATE {
+            return led.TxList[i].Destination
+        }
+    }
+
+    return ""
+}
+
+// Check whether the representatives confirmed tx; confirming a tx confirms
+// every tx before it
+func (led *Ledger) IsConfirmed(hash string) bool {
+    i := led.indexOf(hash)
+    return i >= 0 && i <= led.indexOf(led.Confirmed)
+}
+
+// Mark tx and everything before it as confirmed, returns false if tx isn't
+// in the chain
+func (led *Ledger) confirm(hash string, acc *Account) bool {
+    i := led.indexOf(hash)
+    if i < 0 {
         return false
     }
+
+    if i > led.indexOf(led.Confirmed) {
+        led.Confirmed = hash
+        return led.Write(acc) == nil
     }
+
     return true
 }
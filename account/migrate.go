@@ -0,0 +1,111 @@
+package account
+
+import (
+    "github.com/thomasbeukema/dargent/address"
+    "github.com/thomasbeukema/dargent/store"
+)
+
+// Accounts stored before addresses got a network live under their legacy
+// address; move them, with their ledgers and pending SENDs, to the address of
+// the current network so OpenAccount finds them. Recover does this before
+// anything else opens the store.
+func migrateLegacyAccounts(s store.Store) error {
+    names, err := s.List("")
+    if err != nil {
+        return err
+    }
+
+    for _, name := range names {
+        parsed, err := address.Parse(name)
+        if err != nil || !parsed.Legacy || !AccountExists(s, name) {
+            continue
+        }
+
+        addr, err := address.Normalize(name)
+        if err != nil || AccountExists(s, addr) { // Opened again since, OpenAccount uses that one
+            continue
+        }
+        if err := migrateAccount(s, name, addr); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Move the account stored under legacy to addr. The index under addr is
+// written after everything else and the one under legacy removed last, so an
+// interrupted migration is simply done again.
+func migrateAccount(s store.Store, legacy string, addr string) error {
+    var acc Account
+    if err := readGzipJSON(s, accountKey(legacy), &acc); err != nil {
+        return err
+    }
+
+    currencies, err := s.List(legacy)
+    if err != nil {
+        return err
+    }
+
+    var moved []string
+    for _, currency := range currencies {
+        for _, key := range []func(string, string) string{ledgerKey, journalKey} {
+            value, err := s.Get(key(legacy, currency))
+            if err == store.ErrNotFound {
+                continue
+            }
+            if err != nil {
+                return err
+            }
+            if err := s.Put(key(addr, currency), value); err != nil {
+                return err
+            }
+            moved = append(moved, key(legacy, currency))
+        }
+    }
+
+    pending, err := readPending(s, legacy)
+    if err != nil {
+        return err
+    }
+    if len(pending) > 0 {
+        existing, err := readPending(s, addr)
+        if err != nil {
+            return err
+        }
+        if err := writePending(s, addr, mergePending(existing, pending)); err != nil {
+            return err
+        }
+        moved = append(moved, pendingKey(legacy))
+    }
+
+    acc.Address = addr
+    if err := writeGzipJSON(s, accountKey(addr), acc); err != nil {
+        return err
+    }
+
+    for _, key := range append(moved, accountKey(legacy)) {
+        if err := s.Delete(key); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Pending SENDs of both lists, each once
+func mergePending(a []Pending, b []Pending) []Pending {
+    merged := append([]Pending{}, a...)
+
+    for _, p := range b {
+        known := false
+        for _, q := range a {
+            known = known || q.Hash == p.Hash
+        }
+        if !known {
+            merged = append(merged, p)
+        }
+    }
+
+    return merged
+}
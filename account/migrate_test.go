@@ -0,0 +1,76 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/thomasbeukema/dargent/address"
+	"github.com/thomasbeukema/dargent/store"
+)
+
+// Move the account, its native ledger and pending SENDs to legacy, like a store
+// written before addresses had a network
+func storeAsLegacy(t *testing.T, s store.Store, acc Account, legacy string) {
+	var stored Account
+	if err := readGzipJSON(s, accountKey(acc.Address), &stored); err != nil {
+		t.Fatal(err)
+	}
+	stored.Address = legacy
+	writeGzipJSON(s, accountKey(legacy), stored)
+	s.Delete(accountKey(acc.Address))
+
+	ticker := NativeCurrency().Ticker
+	for _, key := range []func(string, string) string{ledgerKey, journalKey} {
+		value, err := s.Get(key(acc.Address, ticker))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Put(key(legacy, ticker), value)
+		s.Delete(key(acc.Address, ticker))
+	}
+
+	if value, err := s.Get(pendingKey(acc.Address)); err == nil {
+		s.Put(pendingKey(legacy), value)
+		s.Delete(pendingKey(acc.Address))
+	}
+}
+
+func TestRecoverMigratesLegacyAccounts(t *testing.T) {
+	f := newFixture(t)
+	ka, a := f.funded(100)
+	kb, b := f.account()
+	send := f.send(ka, a, b, 30)
+
+	legacy, err := address.EncodeLegacy(kb.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := b.OpenLedger(NativeCurrency().Ticker)
+	storeAsLegacy(t, f.s, b, legacy)
+
+	if _, err := Recover(f.s); err != nil {
+		t.Fatal(err)
+	}
+
+	acc, err := OpenAccount(f.s, legacy, nil)
+	if err != nil || acc.Address != b.Address {
+		t.Fatalf("got %q, %v; want %q", acc.Address, err, b.Address)
+	}
+	if AccountExists(f.s, legacy) {
+		t.Fatal("legacy account left behind")
+	}
+
+	got, err := acc.OpenLedger(NativeCurrency().Ticker)
+	if err != nil || got.Hash != want.Hash {
+		t.Fatalf("ledger %v, %v", got.Hash, err)
+	}
+	pending, _ := PendingFor(f.s, b.Address, NativeCurrency().Ticker)
+	if len(pending) != 1 || pending[0].Hash != send.Hash {
+		t.Fatalf("pending %v", pending)
+	}
+
+	f.claim(kb, acc, send, 30)
+
+	if _, err := Recover(f.s); err != nil { // Nothing left to migrate
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,219 @@
+package account
+
+import (
+    "github.com/thomasbeukema/dargent/store"
+)
+
+// SEND which hasn't been claimed by its destination yet
+type Pending struct {
+    Hash        string      `json:"h"` // Hash of the SEND, the Origin of the CLAIM collecting it
+    Origin      string      `json:"o"` // Address of the sender
+    Amount      Amount      `json:"a"`
+    Currency    Currency    `json:"c"`
+}
+
+// Index lives next to the accounts, one key per destination
+func pendingKey(addr string) string {
+    return store.Key("pending", addr+".json.gz")
+}
+
+// List SENDs to addr in currency which can still be claimed
+func PendingFor(s store.Store, addr string, currency string) ([]Pending, error) {
+    all, err := readPending(s, addr)
+    if err != nil {
+        return nil, err
+    }
+
+    list := make([]Pending, 0)
+    for _, p := range all {
+        if p.Currency.Ticker == currency {
+            list = append(list, p)
+        }
+    }
+
+    return list, nil
+}
+
+// Find the pending SEND to addr with this hash
+func findPending(s store.Store, addr string, hash string) (Pending, bool, error) {
+    list, err := readPending(s, addr)
+    if err != nil {
+        return Pending{}, false, err
+    }
+
+    for _, p := range list {
+        if p.Hash == hash {
+            return p, true, nil
+        }
+    }
+
+    return Pending{}, false, nil
+}
+
+// Add a SEND which just got written to the index of its destination
+func addPending(s store.Store, send Transaction, amount Amount) error {
+    list, err := readPending(s, send.Destination)
+    if err != nil {
+        return err
+    }
+
+    for _, p := range list {
+        if p.Hash == send.Hash {
+            return nil
+        }
+    }
+
+    list = append(list, Pending{send.Hash, send.Origin, amount, send.Currency})
+    return writePending(s, send.Destination, list)
+}
+
+// Remove the SEND with this hash from the index of addr
+func removePending(s store.Store, addr string, hash string) error {
+    list, err := readPending(s, addr)
+    if err != nil {
+        return err
+    }
+
+    for i, p := range list {
+        if p.Hash == hash {
+            return writePending(s, addr, append(list[:i], list[i+1:]...))
+        }
+    }
+
+    return nil
+}
+
+// Bring the index in line with a ledger which was written without going
+// through AddTransaction, e.g. one received from a peer
+func (led *Ledger) UpdatePending(acc *Account) error {
+    claimed := make(map[string]bool)
+
+    for i, tx := range led.TxList {
+        switch tx.Action {
+        case SEND:
+            done, err := isClaimed(acc.store, tx.Destination, tx.Currency.Ticker, tx.Hash)
+            if err != nil {
+                return err
+            }
+            if !done {
+                sent, err := led.balanceBefore(i).Sub(tx.Balance)
+                if err != nil {
+                    return err
+                }
+                if err := addPending(acc.store, tx, sent); err != nil {
+                    return err
+                }
+            }
+        case CLAIM:
+            claimed[tx.Origin] = true
+        }
+    }
+
+    list, err := readPending(acc.store, acc.Address)
+    if err != nil {
+        return err
+    }
+
+    for _, p := range list {
+        if claimed[p.Hash] {
+            if err := removePending(acc.store, acc.Address, p.Hash); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
+// Find the SEND with this hash in the ledgers of currency of all accounts,
+// with the amount it sent
+func findSend(s store.Store, currency string, hash string) (Transaction, Amount, bool, error) {
+    addrs, err := ListAccounts(s)
+    if err != nil {
+        return Transaction{}, 0, false, err
+    }
+
+    for _, addr := range addrs {
+        acc, err := OpenAccount(s, addr, nil)
+        if err != nil {
+            return Transaction{}, 0, false, err
+        }
+        if !acc.HasLedger(currency) {
+            continue
+        }
+
+        led, err := acc.OpenLedger(currency)
+        if err != nil {
+            return Transaction{}, 0, false, err
+        }
+
+        i := led.indexOf(hash)
+        if i < 0 || led.TxList[i].Action != SEND {
+            continue
+        }
+        sent, err := led.balanceBefore(i).Sub(led.TxList[i].Balance)
+        if err != nil {
+            return Transaction{}, 0, false, err
+        }
+        return led.TxList[i], sent, true, nil
+    }
+
+    return Transaction{}, 0, false, nil
+}
+
+// Put the SEND collected by claim back in the index of its destination, after
+// claim was dropped from the chain
+func restorePending(s store.Store, claim Transaction) error {
+    send, amount, ok, err := findSend(s, claim.Currency.Ticker, claim.Origin)
+    if err != nil || !ok {
+        return err
+    }
+
+    return addPending(s, send, amount)
+}
+
+// Check whether the ledger of addr already holds a CLAIM of the SEND hash
+func isClaimed(s store.Store, addr string, currency string, hash string) (bool, error) {
+    if !AccountExists(s, addr) {
+        return false, nil
+    }
+
+    acc, err := OpenAccount(s, addr, nil)
+    if err != nil {
+        return false, err
+    }
+    if !acc.HasLedger(currency) {
+        return false, nil
+    }
+
+    led, err := acc.OpenLedger(currency)
+    if err != nil {
+        return false, err
+    }
+
+    for _, tx := range led.TxList {
+        if tx.Action == CLAIM && tx.Origin == hash {
+            return true, nil
+        }
+    }
+
+    return false, nil
+}
+
+func readPending(s store.Store, addr string) ([]Pending, error) {
+    list := make([]Pending, 0)
+
+    err := readGzipJSON(s, pendingKey(addr), &list)
+    if err == store.ErrNotFound { // Nothing pending
+        return make([]Pending, 0), nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    return list, nil
+}
+
+func writePending(s store.Store, addr string, list []Pending) error {
+    return writeGzipJSON(s, pendingKey(addr), list)
+}
@@ -0,0 +1,226 @@
+package account
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/thomasbeukema/dargent/store"
+)
+
+// Registry of tokens, one entry per ticker holding the currency with its
+// owner. The CREATE of the owner registers a token; a ticker can't be taken
+// again, by the same owner or another one.
+func currencyKey(ticker string) string {
+    return store.Key("currencies", ticker+".json.gz")
+}
+
+// Get the currency registered under ticker
+func LookupCurrency(s store.Store, ticker string) (Currency, error) {
+    if ticker == NativeCurrency().Ticker {
+        return NativeCurrency(), nil
+    }
+
+    var c Currency
+    err := readGzipJSON(s, currencyKey(ticker), &c)
+    if err == store.ErrNotFound {
+        return Currency{}, ErrCurrencyNotFound
+    }
+    if err != nil {
+        return Currency{}, err
+    }
+
+    return c, nil
+}
+
+// List all registered tokens
+func ListCurrencies(s store.Store) ([]Currency, error) {
+    names, err := s.List("currencies")
+    if err != nil {
+        return nil, err
+    }
+
+    list := make([]Currency, 0, len(names))
+    for _, name := range names {
+        if !strings.HasSuffix(name, ".json.gz") {
+            continue
+        }
+
+        c, err := LookupCurrency(s, strings.TrimSuffix(name, ".json.gz"))
+        if err != nil {
+            return nil, err
+        }
+        list = append(list, c)
+    }
+
+    return list, nil
+}
+
+// Check that c can be registered: its ticker is free or already registered
+// for exactly c
+func checkCurrencyAvailable(s store.Store, c Currency) error {
+    registered, err := LookupCurrency(s, c.Ticker)
+    if errors.Is(err, ErrCurrencyNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if registered != c {
+        return fmt.Errorf("%w: %s", ErrCurrencyExists, c.Ticker)
+    }
+
+    return nil
+}
+
+// Register the token the ledger of its owner starts with; nothing to do for
+// other ledgers
+func (led *Ledger) registerCurrency(acc *Account) error {
+    if len(led.TxList) == 0 {
+        return nil
+    }
+
+    c := led.TxList[0].Currency
+    if c.IsNative() || c.Owner != acc.Address {
+        return nil
+    }
+
+    if err := checkCurrencyAvailable(acc.store, c); err != nil {
+        return err
+    }
+    if store.Exists(acc.store, currencyKey(c.Ticker)) {
+        return nil
+    }
+
+    return writeGzipJSON(acc.store, currencyKey(c.Ticker), c)
+}
+
+// Tokens in circulation after the txs before position i of the ledger of the
+// owner: the supply of the CREATE, plus what was minted, minus what was burnt.
+// ErrAmountOverflow when that doesn't fit in an Amount.
+func (led *Ledger) supplyBefore(i int) (Amount, error) {
+    var supply, balance Amount
+
+    for j := 0; j < i && j < len(led.TxList); j++ {
+        tx := led.TxList[j]
+
+        var moved Amount
+        var err error
+        switch tx.Action {
+        case CREATE:
+            supply = tx.Balance
+        case MINT:
+            if moved, err = tx.Balance.Sub(balance); err == nil {
+                supply, err = supply.Add(moved)
+            }
+        case BURN:
+            if moved, err = balance.Sub(tx.Balance); err == nil {
+                supply, err = supply.Sub(moved)
+            }
+        }
+        if err != nil {
+            return 0, err
+        }
+
+        switch tx.Action {
+        case SEND, CLAIM, CREATE, MINT, BURN:
+            balance = tx.Balance
+        }
+    }
+
+    return supply, nil
+}
+
+// Get the number of tokens of ticker in circulation
+func TotalSupply(s store.Store, ticker string) (Amount, error) {
+    c, err := LookupCurrency(s, ticker)
+    if err != nil {
+        return 0, err
+    }
+    if c.IsNative() {
+        return 0, fmt.Errorf("%w: %s has no owner", ErrCurrencyNotFound, ticker)
+    }
+
+    owner, err := OpenAccount(s, c.Owner, nil)
+    if err != nil {
+        return 0, err
+    }
+    if !owner.HasLedger(ticker) {
+        return 0, ErrLedgerNotFound
+    }
+
+    led, err := owner.OpenLedger(ticker)
+    if err != nil {
+        return 0, err
+    }
+
+    return led.supplyBefore(len(led.TxList))
+}
+
+// Check that the balances of all accounts and the SENDs not claimed yet add
+// up to the supply of the token ticker
+func VerifySupply(s store.Store, ticker string) error {
+    supply, err := TotalSupply(s, ticker)
+    if err != nil {
+        return err
+    }
+
+    var total Amount
+    add := func(amount Amount) error {
+        sum, err := total.Add(amount)
+        if err != nil {
+            return fmt.Errorf("%w: %s overflows", ErrSupplyMismatch, ticker)
+        }
+        total = sum
+        return nil
+    }
+
+    addrs, err := ListAccounts(s)
+    if err != nil {
+        return err
+    }
+    for _, addr := range addrs {
+        acc, err := OpenAccount(s, addr, nil)
+        if err != nil {
+            return err
+        }
+        if !acc.HasLedger(ticker) {
+            continue
+        }
+
+        led, err := acc.OpenLedger(ticker)
+        if err != nil {
+            return err
+        }
+        if err := add(led.Balance()); err != nil {
+            return err
+        }
+    }
+
+    names, err := s.List("pending")
+    if err != nil {
+        return err
+    }
+    for _, name := range names {
+        list, err := readPending(s, strings.TrimSuffix(name, ".json.gz"))
+        if err != nil {
+            return err
+        }
+
+        for _, p := range list {
+            if p.Currency.Ticker != ticker {
+                continue
+            }
+            if err := add(p.Amount); err != nil {
+                return err
+            }
+        }
+    }
+
+    if total != supply {
+        c, _ := LookupCurrency(s, ticker)
+        return fmt.Errorf("%w: %s held, %s issued", ErrSupplyMismatch, c.Format(total), c.Format(supply))
+    }
+
+    return nil
+}
@@ -0,0 +1,155 @@
+package account
+
+import (
+	"errors"
+	"testing"
+)
+
+// Balance of the ledger of ticker of acc
+func (f *fixture) balanceOf(acc Account, ticker string) Amount {
+	led, err := acc.OpenLedger(ticker)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return led.Balance()
+}
+
+func TestMintBurnOnlyByOwner(t *testing.T) {
+	f := newFixture(t)
+	ko, owner := f.funded(100)
+	c := f.token(ko, owner, "GLD", 1000, true)
+	kh, h := f.holder(c)
+	f.add(h, f.claimToken(kh, h, f.sendToken(ko, owner, h, c, 100), 100))
+
+	mint, _ := NewMintTransaction(owner.Address, f.lastOf(owner, c.Ticker).Hash, f.balanceOf(owner, c.Ticker)+500, c, ko)
+	f.add(owner, mint)
+	burn, _ := NewBurnTransaction(owner.Address, mint.Hash, f.balanceOf(owner, c.Ticker)-200, c, ko)
+	f.add(owner, burn)
+
+	if supply, err := TotalSupply(f.s, c.Ticker); err != nil || supply != 1300 {
+		t.Fatalf("supply %d, %v", supply, err)
+	}
+
+	mint, _ = NewMintTransaction(h.Address, f.lastOf(h, c.Ticker).Hash, 600, c, kh)
+	if h.AddTransaction(mint) == nil {
+		t.Fatal("holder minted")
+	}
+	burn, _ = NewBurnTransaction(h.Address, f.lastOf(h, c.Ticker).Hash, 50, c, kh)
+	if h.AddTransaction(burn) == nil {
+		t.Fatal("holder burnt")
+	}
+	mint, _ = NewMintTransaction(owner.Address, burn.Hash, f.balanceOf(owner, c.Ticker)+1, c, kh)
+	if owner.AddTransaction(mint) == nil {
+		t.Fatal("holder minted on the ledger of the owner")
+	}
+
+	fixed := f.token(ko, owner, "FXD", 1000, false)
+	mint, _ = NewMintTransaction(owner.Address, f.lastOf(owner, fixed.Ticker).Hash, 2000, fixed, ko)
+	if owner.AddTransaction(mint) == nil {
+		t.Fatal("minted a token which isn't mintable")
+	}
+
+	for _, ticker := range []string{c.Ticker, fixed.Ticker} {
+		if err := VerifySupply(f.s, ticker); err != nil {
+			t.Fatal(ticker, err)
+		}
+	}
+}
+
+func TestTickerIsUnique(t *testing.T) {
+	f := newFixture(t)
+	ko, owner := f.funded(100)
+	c := f.token(ko, owner, "GLD", 1000, false)
+
+	kp, acc := f.account()
+	other := NewCurrency("Fool's gold", c.Ticker, acc.Address, 2, 1000, false)
+	create, _ := NewCreateTokenTransaction(base64Key(kp.PublicKey), other, 1000, kp)
+	if err := acc.AddTransaction(create); !errors.Is(err, ErrCurrencyExists) {
+		t.Fatalf("took a registered ticker: got %v, want ErrCurrencyExists", err)
+	}
+
+	if registered, err := LookupCurrency(f.s, c.Ticker); err != nil || registered != c {
+		t.Fatalf("registered %+v, %v", registered, err)
+	}
+	if list, err := ListCurrencies(f.s); err != nil || len(list) != 1 {
+		t.Fatalf("currencies %v, %v", list, err)
+	}
+	if NewCurrency("Argent", NativeCurrency().Ticker, acc.Address, 8, 1, false).Validate() == nil {
+		t.Fatal("token named after the native currency")
+	}
+}
+
+func TestMintCantOverflowSupply(t *testing.T) {
+	f := newFixture(t)
+	ko, owner := f.funded(100)
+	c := f.token(ko, owner, "BIG", MaxAmount, true)
+	kh, h := f.holder(c)
+	f.add(h, f.claimToken(kh, h, f.sendToken(ko, owner, h, c, MaxAmount-1), MaxAmount-1))
+
+	// The owner only holds 1, but there are MaxAmount in circulation
+	mint, _ := NewMintTransaction(owner.Address, f.lastOf(owner, c.Ticker).Hash, 5, c, ko)
+	if err := owner.AddTransaction(mint); !errors.Is(err, ErrInvalidBalance) {
+		t.Fatalf("minted past MaxAmount: got %v, want ErrInvalidBalance", err)
+	}
+
+	burn, _ := NewBurnTransaction(owner.Address, f.lastOf(owner, c.Ticker).Hash, 0, c, ko)
+	f.add(owner, burn)
+	if supply, err := TotalSupply(f.s, c.Ticker); err != nil || supply != MaxAmount-1 {
+		t.Fatalf("supply %d, %v", supply, err)
+	}
+}
+
+func TestVerifySupply(t *testing.T) {
+	f := newFixture(t)
+	ko, owner := f.funded(100)
+	c := f.token(ko, owner, "GLD", 1000, false)
+	kh, h := f.holder(c)
+	_, unclaimed := f.holder(c)
+
+	f.add(h, f.claimToken(kh, h, f.sendToken(ko, owner, h, c, 100), 100))
+	f.sendToken(ko, owner, unclaimed, c, 50) // Only counted as pending
+	f.sendToken(kh, h, owner, c, 30)
+
+	if err := VerifySupply(f.s, c.Ticker); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TotalSupply(f.s, NativeCurrency().Ticker); !errors.Is(err, ErrCurrencyNotFound) {
+		t.Fatal("supply of ART", err)
+	}
+
+	forged := Transaction{Hash: "forged", Action: SEND, Origin: owner.Address, Destination: h.Address, Currency: c}
+	if err := addPending(f.s, forged, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySupply(f.s, c.Ticker); !errors.Is(err, ErrSupplyMismatch) {
+		t.Fatalf("got %v, want ErrSupplyMismatch", err)
+	}
+	if _, err := Recover(f.s); !errors.Is(err, ErrSupplyMismatch) {
+		t.Fatalf("recover: got %v, want ErrSupplyMismatch", err)
+	}
+}
+
+func TestSupplyBeforeIsChecked(t *testing.T) {
+	led := Ledger{TxList: []Transaction{
+		{Action: CREATE, Balance: 10},
+		{Action: CLAIM, Balance: 100},
+		{Action: BURN, Balance: 0},
+	}}
+
+	if supply, err := led.supplyBefore(2); err != nil || supply != 10 {
+		t.Fatalf("supply %d, %v", supply, err)
+	}
+	if _, err := led.supplyBefore(3); !errors.Is(err, ErrAmountOverflow) {
+		t.Fatalf("burnt more than the supply: got %v, want ErrAmountOverflow", err)
+	}
+
+	led.TxList[2] = Transaction{Action: MINT, Balance: MaxAmount}
+	if _, err := led.supplyBefore(3); err != nil {
+		t.Fatal(err)
+	}
+	led.TxList[1].Balance = 5
+	if _, err := led.supplyBefore(3); !errors.Is(err, ErrAmountOverflow) {
+		t.Fatalf("minted past MaxAmount: got %v, want ErrAmountOverflow", err)
+	}
+}
@@ -1,16 +1,12 @@
 package account
 
 import (
-	"fmt"
-	"encoding/json"
+	"bytes"
 	"encoding/base64"
-	"crypto/sha256"
 	_ "crypto/ecdsa"
 	_ "crypto/elliptic"
 	_ "math/big"
-	"time"
 	"strconv"
-	"errors"
 
 	"github.com/thomasbeukema/dargent/address"
 )
@@ -22,157 +18,200 @@ const (
 	CLAIM // 1
 	CREATE // 2
 	TRUST // 3
+	DELEGATE // 4
+	MINT // 5, issue more of a mintable token
+	BURN // 6, destroy tokens
+	REVOKE // 7, issuer withdraws the trust line of a holder
 )
 
 // Define struct for transaction structure
 type Transaction struct {
 	Hash			string				`json:"h"`				// Hash for authenticity and txId
 	PreviousHash	string				`json:"p,omitempty"`	// Hash of the previous tx
-	Action			transactionType		`json:"a"`				// Type of transaction [SEND, CLAIM, CREATE, TRUST]
-	Balance			uint64				`json:"b,omitempty"`	// Balance of the address; balance, not the tx amount
+	Action			transactionType		`json:"a"`				// Type of transaction [SEND, CLAIM, CREATE, TRUST, DELEGATE, MINT, BURN, REVOKE]
+	Balance			Amount				`json:"b,omitempty"`	// Balance of the address; balance, not the tx amount
 	Currency		Currency			`json:"c,omitempty"`	// Currency of the tx
 	Origin			string				`json:"o"`				// SENDer / src tx for claim tx
 	Destination		string				`json:"d,omitempty"`	// Receiver
-	Expiration		string				`json:"e,omitempty"`	// Expiration for trust certificates
+	Expiration		string				`json:"e,omitempty"`	// Expiration for trust certificates, Unix time in ns; empty or 0 never expires
+	Signature		string				`json:"s,omitempty"`	// Signature of Hash by the account the tx belongs to
+	Work			uint64				`json:"w,omitempty"`	// Proof of work over the root of the tx, see GenerateWork
 }
 
-// Generate hash for a transaction to ensure the authenticity of the contents of the transaction
-func (tx *Transaction) GenerateHash() (string, error) {
-	switch tx.Action { // Every type of transaction has a slightly different way of calculating the hash
-		case SEND:
-			minTx := Transaction{ // Fill in important parts for the hash
-				Hash: "",
-				PreviousHash: tx.PreviousHash,
-				Action: SEND,
-				Balance: tx.Balance,
-				Currency: tx.Currency,
-				Origin: tx.Origin,
-				Destination: tx.Destination,
-			}
+// Hash tx and sign it with the key of the account it belongs to; needed again
+// after changing any of its fields
+func (tx *Transaction) Sign(signer address.Signer) error {
+	hash, err := tx.GenerateHash()
+	if err != nil {
+		return err
+	}
+	tx.Hash = hash
 
-			txJson, err := json.Marshal(minTx) // Encode tx in JSON
-			if err != nil {
-				return "", err
-			}
+	signature, err := signer.Sign([]byte(tx.Hash))
+	if err != nil {
+		return err
+	}
+	tx.Signature = signature
+
+	return nil
+}
 
-			hash := sha256.Sum256(txJson) // Generate SHA-256 hash of json content
+// Sign tx as one cosigner of the multisig account it belongs to. Once enough
+// partials are gathered, Sign with an address.Cosigned holding them.
+func (tx *Transaction) SignPartial(key address.MultisigKey, signer address.Signer) (address.PartialSignature, error) {
+	hash, err := tx.GenerateHash()
+	if err != nil {
+		return address.PartialSignature{}, err
+	}
+	tx.Hash = hash
 
-		return fmt.Sprintf("%v%x", int(tx.Action), hash[:]), nil // Return hash with the txtype in front for convenience later on
+	return key.SignPartial(signer, []byte(tx.Hash))
+}
 
+// Generate hash for a transaction to ensure the authenticity of the contents
+// of the transaction, see encoding.go
+func (tx *Transaction) GenerateHash() (string, error) {
+	switch tx.Action {
+		case SEND, CREATE, TRUST, DELEGATE, MINT, BURN, REVOKE:
 		case CLAIM:
-			minTx := Transaction{
-				Hash: "",
-				PreviousHash: tx.PreviousHash,
-				Action: SEND,
-				Origin: tx.Origin,
-				Destination: tx.Destination,
-			}
-
-			txJson, err := json.Marshal(minTx)
-			if err != nil {
-				return "", err
+			if tx.PreviousHash == "" { // A claim always follows the CREATE at least
+				return "", ErrInvalidTransaction
 			}
+		default:
+			return "", ErrInvalidTransaction
+	}
 
-			hash := sha256.Sum256(txJson)
+	return tx.canonicalHash(), nil
+}
 
-			return fmt.Sprintf("%v%x", int(tx.Action), hash[:]) + tx.PreviousHash[:1], nil // For claim transaction, also put type of connected tx after hash for convenience
+// Verify if tx is valid, carries enough work and is signed by the key of the
+// account it belongs to
+func (tx *Transaction) Verify(v address.Verifier) bool {
+	if v == nil {
+		return false
+	}
 
-		case CREATE:
-			minTx := Transaction{
-				Hash: "",
-				Action: CREATE,
-				Balance: tx.Balance,
-				Currency: tx.Currency,
-				Origin: tx.Origin,
+	switch tx.Action { // Each txtype has other factors to determine if tx is valid
+		case SEND:
+			if !canonicalAddress(tx.Origin) {
+				return false
 			}
-
-			txJson, err := json.Marshal(minTx)
-			if err != nil {
-				return "", err
+			if !canonicalAddress(tx.Destination) {
+				return false
 			}
-
-			hash := sha256.Sum256(txJson)
-
-			return fmt.Sprintf("%v%x", int(tx.Action), hash[:]), nil
-
-		case TRUST:
-			minTx := Transaction{
-				Hash: "",
-				PreviousHash: tx.PreviousHash,
-				Action: TRUST,
-				Origin: tx.Origin,
-				Destination: tx.Destination,
-				Expiration: tx.Origin,
+		case CLAIM: // The SEND in Origin is checked by the ledger, see checkClaim
+			if tx.Origin == "" {
+				return false
 			}
-
-			txJson, err := json.Marshal(minTx)
-			if err != nil {
-				return "", err
+			if !canonicalAddress(tx.Destination) {
+				return false
 			}
-
-			hash := sha256.Sum256(txJson)
-
-			return fmt.Sprintf("%v%x", int(tx.Action), hash[:]), nil
-
-		default:
-			return "", errors.New("Invalid Transaction Type")
-	}
-}
-
-// Verify if tx is valid
-func (tx *Transaction) Verify() bool {
-	switch tx.Action { // Each txtype has other factors to determine if tx is valid
-		case SEND:
-			if tx.Balance < 0 { // Balance can't be negative
+		case CREATE: // Origin holds the public key of the account, which signs its own CREATE
+			if tx.Currency.Validate() != nil {
 				return false
 			}
-			if address.ValidateAddress(tx.Origin) != true {
+			origin, err := base64.StdEncoding.DecodeString(tx.Origin)
+			if err != nil || address.TypeOfPublicKey(origin) == address.UNKNOWN || !bytes.Equal(origin, v.GetPublicKey()) {
 				return false
 			}
-			if address.ValidateAddress(tx.Destination) != true {
+		case TRUST: // Toward the issuer of a token; whether it expired matters when claiming, see trusts
+			if _, err := tx.expiration(); err != nil {
 				return false
 			}
-		case CLAIM:
-			// TODO: Check origin tx
-			if address.ValidateAddress(tx.Destination) != true {
+			if tx.Currency.IsNative() || tx.Currency.Validate() != nil {
 				return false
 			}
-		case CREATE:
-			if tx.Balance == 0 && tx.Currency != NativeCurrency() {
+			if !canonicalAddress(tx.Origin) {
 				return false
 			}
-			if tx.Currency != NativeCurrency() { // No origin when creating token, since it's stored in currency struct
-				if address.ValidateAddress(tx.Currency.Owner) != true {
-					return false
-				}
-			} else {
-				if address.ValidateAddress(tx.Origin) != true {
-					return false
-				}
+			if tx.Destination != tx.Currency.Owner || tx.Destination == tx.Origin {
+				return false
+			}
+		case DELEGATE:
+			if tx.Currency != NativeCurrency() { // Only the native balance gives weight
+				return false
 			}
-		case TRUST:
-			currentTime := time.Now().UnixNano()
-			expiring, _ := strconv.ParseInt(tx.Expiration, 10, 64)
-			// TODO: Check for error
-			if currentTime > expiring && expiring != 0 { // Check if trust certificate isn't expired; token trust expiring is always 0
+			if !canonicalAddress(tx.Origin) {
 				return false
 			}
-			if address.ValidateAddress(tx.Origin) != true {
+			if !canonicalAddress(tx.Destination) { // Representative
 				return false
 			}
-			if address.ValidateAddress(tx.Destination) != true {
+		case MINT, BURN: // Only by the owner, see checkBalance
+			if tx.Currency.IsNative() || tx.Currency.Validate() != nil {
 				return false
 			}
+			if tx.Action == MINT && !tx.Currency.Mintable {
+				return false
+			}
+			if tx.Origin != tx.Currency.Owner {
+				return false
+			}
+		case REVOKE: // Only by the issuer, see checkToken
+			if tx.Currency.IsNative() || tx.Currency.Validate() != nil {
+				return false
+			}
+			if tx.Origin != tx.Currency.Owner {
+				return false
+			}
+			if !canonicalAddress(tx.Destination) || tx.Destination == tx.Origin {
+				return false
+			}
+		default:
+			return false
+	}
+
+	if !ValidWork(tx.WorkRoot(), tx.Work, WorkDifficulty()) {
+		return false
 	}
 
 	if h, _ := tx.GenerateHash(); tx.Hash != h { // Check the authenticity of the content
 		return false
 	}
 
-	return true
+	return v.Verify(tx.Signature, []byte(tx.Hash)) == nil
 }
 
-func NewSendTransaction(account string, ph string, destination string, amount uint64, c Currency) (Transaction, error) {
+// Moment a TRUST expires, 0 if it doesn't
+func (tx *Transaction) expiration() (int64, error) {
+	if tx.Expiration == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(tx.Expiration, 10, 64)
+}
+
+// Addresses in transactions must be valid for this network and in the form
+// accounts are stored under, see address.Normalize
+func canonicalAddress(addr string) bool {
+	normalized, err := address.Normalize(addr)
+	return err == nil && normalized == addr
+}
+
+// Address of the account on whose chain tx belongs
+func (tx *Transaction) AccountAddress() string {
+	switch tx.Action {
+		case SEND, TRUST, DELEGATE, MINT, BURN, REVOKE:
+			return tx.Origin
+		case CLAIM:
+			return tx.Destination
+		case CREATE: // Of the native currency or a token, by its owner or a holder
+			pubkey, err := base64.StdEncoding.DecodeString(tx.Origin)
+			if err != nil {
+				return ""
+			}
+			return address.PubKeyToAddress(pubkey)
+	}
+
+	return ""
+}
+
+func NewSendTransaction(account string, ph string, destination string, amount Amount, c Currency, signer address.Signer) (Transaction, error) {
+	destination, err := address.Normalize(destination) // Legacy addresses still work
+	if err != nil {
+		return Transaction{}, err
+	}
+
 	tx := Transaction{
 		Hash: "",
 		PreviousHash: ph,
@@ -183,26 +222,29 @@ func NewSendTransaction(account string, ph string, destination string, amount ui
 		Destination: destination,
 	}
 
-	tx.Hash,_ = tx.GenerateHash()
+	err = tx.Sign(signer)
 
-	return tx, nil
+	return tx, err
 }
 
-func NewClaimTransaction(account string, ph string, txId string) (Transaction, error) {
+// Claim the SEND txId; balance is the balance after adding the amount sent
+func NewClaimTransaction(account string, ph string, txId string, balance Amount, c Currency, signer address.Signer) (Transaction, error) {
 	tx := Transaction{
 		Hash: "",
 		PreviousHash: ph,
 		Action: CLAIM,
+		Balance: balance,
+		Currency: c,
 		Origin: txId,
 		Destination: account,
 	}
 
-	tx.Hash,_ = tx.GenerateHash()
+	err := tx.Sign(signer)
 
-	return tx, nil
+	return tx, err
 }
 
-func NewCreateTransaction(pubkey []byte) (Transaction, error) {
+func NewCreateTransaction(pubkey []byte, signer address.Signer) (Transaction, error) {
 	b64pubkey := base64.StdEncoding.EncodeToString(pubkey)
 
 	tx := Transaction{
@@ -213,36 +255,117 @@ func NewCreateTransaction(pubkey []byte) (Transaction, error) {
 		Origin: b64pubkey,
 	}
 
-	tx.Hash,_ = tx.GenerateHash()
+	err := tx.Sign(signer)
 
-	return tx, nil
+	return tx, err
 }
 
-func NewCreateTokenTransaction(pubkey string, c Currency, amount uint64) (Transaction, error) {
+// Open the ledger of token c for the account with the base64 pubkey. The owner
+// issues the supply of c with it, so amount has to be c.Supply; holders open
+// their ledger with an amount of 0 before they can claim the token.
+func NewCreateTokenTransaction(pubkey string, c Currency, amount Amount, signer address.Signer) (Transaction, error) {
 	tx := Transaction{
 		Hash: "",
 		Action: CREATE,
 		Currency: c,
 		Balance: amount,
+		Origin: pubkey,
 	}
 
-	tx.Hash,_ = tx.GenerateHash()
+	err := tx.Sign(signer)
 
-	return tx, nil
+	return tx, err
 }
 
-func NewTrustTransaction(account string, destination string, expiration string) (Transaction, error) {
+// Mint tokens of c, owned by account; balance is the balance after minting
+func NewMintTransaction(account string, ph string, balance Amount, c Currency, signer address.Signer) (Transaction, error) {
 	tx := Transaction{
 		Hash: "",
-		PreviousHash: "",
+		PreviousHash: ph,
+		Action: MINT,
+		Balance: balance,
+		Currency: c,
+		Origin: account,
+	}
+
+	err := tx.Sign(signer)
+
+	return tx, err
+}
+
+// Burn tokens of c, owned by account; balance is the balance after burning
+func NewBurnTransaction(account string, ph string, balance Amount, c Currency, signer address.Signer) (Transaction, error) {
+	tx := Transaction{
+		Hash: "",
+		PreviousHash: ph,
+		Action: BURN,
+		Balance: balance,
+		Currency: c,
+		Origin: account,
+	}
+
+	err := tx.Sign(signer)
+
+	return tx, err
+}
+
+// Trust the issuer of token c, so account can claim it; expiration is Unix
+// time in ns, or empty to trust until revoked
+func NewTrustTransaction(account string, ph string, c Currency, expiration string, signer address.Signer) (Transaction, error) {
+	tx := Transaction{
+		Hash: "",
+		PreviousHash: ph,
 		Action: TRUST,
+		Currency: c,
 		Origin: account,
-		Destination: destination,
+		Destination: c.Owner,
 		Expiration: expiration,
 	}
 
-	tx.Hash,_ = tx.GenerateHash()
-	tx.PreviousHash,_ = tx.GenerateHash()
+	err := tx.Sign(signer)
+
+	return tx, err
+}
+
+// Revoke the trust line of holder for token c, owned by account; holder can't
+// claim c anymore
+func NewRevokeTransaction(account string, ph string, holder string, c Currency, signer address.Signer) (Transaction, error) {
+	holder, err := address.Normalize(holder) // Legacy addresses still work
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	tx := Transaction{
+		Hash: "",
+		PreviousHash: ph,
+		Action: REVOKE,
+		Currency: c,
+		Origin: account,
+		Destination: holder,
+	}
+
+	err = tx.Sign(signer)
+
+	return tx, err
+}
+
+// Delegate the weight of account to representative
+func NewDelegateTransaction(account string, ph string, representative string, signer address.Signer) (Transaction, error) {
+	representative, err := address.Normalize(representative) // Legacy addresses still work
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	tx := Transaction{
+		Hash: "",
+		PreviousHash: ph,
+		Action: DELEGATE,
+		Currency: NativeCurrency(),
+		Origin: account,
+		Destination: representative,
+	}
+
+	err = tx.Sign(signer)
 
-	return tx, nil
+	return tx, err
 }
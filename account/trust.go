@@ -0,0 +1,115 @@
+package account
+
+import (
+    "time"
+
+    "github.com/thomasbeukema/dargent/store"
+)
+
+// Trust lines: before an account can claim a token it has to TRUST the issuer
+// on its ledger of that token. A trust line holds while the TRUST hasn't
+// expired and the issuer hasn't revoked it with a REVOKE on its own ledger.
+// The issuer and the native currency need no trust.
+
+// Check whether acc may hold c at moment now
+func (led *Ledger) trusts(c Currency, acc *Account, now time.Time) (bool, error) {
+    if c.IsNative() || c.Owner == acc.Address {
+        return true, nil
+    }
+
+    trusted := false
+    for _, tx := range led.TxList {
+        if tx.Action != TRUST || tx.Currency != c {
+            continue
+        }
+
+        expiration, err := tx.expiration()
+        if err == nil && (expiration == 0 || expiration > now.UnixNano()) {
+            trusted = true
+            break
+        }
+    }
+    if !trusted {
+        return false, nil
+    }
+
+    revoked, err := isRevoked(acc.store, c, acc.Address)
+    return !revoked, err
+}
+
+// Check whether the issuer of c revoked the trust line of addr. Without a copy
+// of the ledger of the issuer nothing is known to be revoked.
+func isRevoked(s store.Store, c Currency, addr string) (bool, error) {
+    if !AccountExists(s, c.Owner) {
+        return false, nil
+    }
+
+    issuer, err := OpenAccount(s, c.Owner, nil)
+    if err != nil {
+        return false, err
+    }
+    if !issuer.HasLedger(c.Ticker) {
+        return false, nil
+    }
+
+    led, err := issuer.OpenLedger(c.Ticker)
+    if err != nil {
+        return false, err
+    }
+
+    for _, tx := range led.TxList {
+        if tx.Action == REVOKE && tx.Currency == c && tx.Destination == addr {
+            return true, nil
+        }
+    }
+
+    return false, nil
+}
+
+// Check whether the account trusts the issuer of c right now
+func (acc *Account) Trusts(c Currency) (bool, error) {
+    if !acc.HasLedger(c.Ticker) {
+        return c.IsNative() || c.Owner == acc.Address, nil
+    }
+
+    led, err := acc.OpenLedger(c.Ticker)
+    if err != nil {
+        return false, err
+    }
+
+    return led.trusts(c, acc, time.Now())
+}
+
+// List the addresses of all accounts trusting the issuer of c, the issuer
+// itself excluded
+func TrustingAccounts(s store.Store, c Currency) ([]string, error) {
+    addrs, err := ListAccounts(s)
+    if err != nil {
+        return nil, err
+    }
+
+    trusting := make([]string, 0)
+    for _, addr := range addrs {
+        if addr == c.Owner {
+            continue
+        }
+
+        acc, err := OpenAccount(s, addr, nil)
+        if err != nil {
+            return nil, err
+        }
+        if !acc.HasLedger(c.Ticker) {
+            continue
+        }
+
+        trusted, err := acc.Trusts(c)
+        if err != nil {
+            return nil, err
+        }
+        if trusted {
+            trusting = append(trusting, addr)
+        }
+    }
+
+    return trusting, nil
+}
@@ -0,0 +1,110 @@
+package account
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClaimNeedsTrust(t *testing.T) {
+	f := newFixture(t)
+	ko, owner := f.funded(100)
+	c := f.token(ko, owner, "GLD", 1000, false)
+
+	kp, acc := f.account()
+	create, _ := NewCreateTokenTransaction(base64Key(kp.PublicKey), c, 0, kp)
+	f.add(acc, create)
+	send := f.sendToken(ko, owner, acc, c, 10)
+
+	if err := acc.AddTransaction(f.claimToken(kp, acc, send, 10)); !errors.Is(err, ErrNotTrusted) {
+		t.Fatalf("claim without TRUST: got %v, want ErrNotTrusted", err)
+	}
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano(), 10)
+	trust, _ := NewTrustTransaction(acc.Address, create.Hash, c, expired, kp)
+	f.add(acc, trust)
+	if err := acc.AddTransaction(f.claimToken(kp, acc, send, 10)); !errors.Is(err, ErrNotTrusted) {
+		t.Fatalf("claim after TRUST expired: got %v, want ErrNotTrusted", err)
+	}
+
+	trust, _ = NewTrustTransaction(acc.Address, trust.Hash, c, "", kp)
+	f.add(acc, trust)
+	f.add(acc, f.claimToken(kp, acc, send, 10))
+}
+
+func TestRevoke(t *testing.T) {
+	f := newFixture(t)
+	ko, owner := f.funded(100)
+	c := f.token(ko, owner, "GLD", 1000, false)
+	_, a := f.holder(c)
+	kb, b := f.holder(c)
+	f.account() // Without a ledger of the token
+
+	if list, err := TrustingAccounts(f.s, c); err != nil || len(list) != 2 {
+		t.Fatalf("trusting %v, %v", list, err)
+	}
+
+	send := f.sendToken(ko, owner, b, c, 10)
+
+	notOwner, _ := NewRevokeTransaction(b.Address, f.lastOf(b, c.Ticker).Hash, a.Address, c, kb)
+	if b.AddTransaction(notOwner) == nil {
+		t.Fatal("holder revoked another holder")
+	}
+
+	revoke, err := NewRevokeTransaction(owner.Address, send.Hash, b.Address, c, ko)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.add(owner, revoke)
+
+	if trusted, err := b.Trusts(c); err != nil || trusted {
+		t.Fatal("revoked holder still trusts", err)
+	}
+	if list, _ := TrustingAccounts(f.s, c); len(list) != 1 || list[0] != a.Address {
+		t.Fatalf("trusting %v, want only %s", list, a.Address)
+	}
+	if err := b.AddTransaction(f.claimToken(kb, b, send, 10)); !errors.Is(err, ErrNotTrusted) {
+		t.Fatalf("claim after REVOKE: got %v, want ErrNotTrusted", err)
+	}
+}
+
+// A ledger from a peer can't hold CLAIMs of a token the account doesn't
+// trust at that point
+func TestBackedLengthChecksTrust(t *testing.T) {
+	f := newFixture(t)
+	ko, owner := f.funded(100)
+	c := f.token(ko, owner, "GLD", 1000, false)
+
+	kp, acc := f.account()
+	create, _ := NewCreateTokenTransaction(base64Key(kp.PublicKey), c, 0, kp)
+	f.add(acc, create)
+	send := f.sendToken(ko, owner, acc, c, 10)
+
+	trust, _ := NewTrustTransaction(acc.Address, create.Hash, c, "", kp)
+	claim, _ := NewClaimTransaction(acc.Address, trust.Hash, send.Hash, 10, c, kp)
+	untrusted, _ := NewClaimTransaction(acc.Address, create.Hash, send.Hash, 10, c, kp)
+	early, _ := NewTrustTransaction(acc.Address, untrusted.Hash, c, "", kp)
+
+	for _, l := range []struct {
+		name	string
+		txs		[]Transaction
+		want	int
+	}{
+		{"trusted", []Transaction{create, trust, claim}, 3},
+		{"no TRUST", []Transaction{create, untrusted}, 1},
+		{"TRUST after the CLAIM", []Transaction{create, untrusted, early}, 1},
+	} {
+		led := Ledger{Currency: c.Ticker, TxList: l.txs}
+		if got, err := led.BackedLength(f.s, acc.Address); err != nil || got != l.want {
+			t.Errorf("%s: backed %d, want %d, %v", l.name, got, l.want, err)
+		}
+	}
+
+	revoke, _ := NewRevokeTransaction(owner.Address, send.Hash, acc.Address, c, ko)
+	f.add(owner, revoke)
+	led := Ledger{Currency: c.Ticker, TxList: []Transaction{create, trust, claim}}
+	if got, _ := led.BackedLength(f.s, acc.Address); got != 2 {
+		t.Fatalf("revoked: backed %d, want 2", got)
+	}
+}
@@ -0,0 +1,294 @@
+package account
+
+import (
+    "sync"
+    "time"
+
+    "github.com/thomasbeukema/dargent/address"
+    "github.com/thomasbeukema/dargent/store"
+)
+
+const (
+    // Percentage of all delegated weight which has to vote for a tx to confirm it
+    QuorumPercentage = 67
+    // Representatives which haven't voted for this long count as offline
+    onlineWindow = 5 * time.Minute
+    // How long computed weights are reused before scanning all accounts again
+    weightRefreshInterval = 10 * time.Second
+    // Elections which didn't reach quorum in this time are dropped
+    electionTimeout = 10 * time.Minute
+)
+
+// Signed statement of a representative that it accepted a tx
+type Vote struct {
+    Representative  string  `json:"r"`
+    TxHash          string  `json:"t"`
+    Signature       string  `json:"s"`
+}
+
+// Vote on tx as the representative owning signer
+func NewVote(signer address.Signer, txHash string) (Vote, error) {
+    signature, err := signer.Sign(voteMessage(txHash))
+    if err != nil {
+        return Vote{}, err
+    }
+
+    return Vote{
+        Representative: signer.GetAddress(),
+        TxHash: txHash,
+        Signature: signature,
+    }, nil
+}
+
+// Votes are signed with a prefix, so they can't be mistaken for other signatures
+func voteMessage(txHash string) []byte {
+    return []byte("vote:" + txHash)
+}
+
+// Check the signature of the vote against the key of the representative
+func (v *Vote) Verify(s store.Store) bool {
+    if !address.ValidateAddress(v.Representative) {
+        return false
+    }
+
+    rep, err := OpenAccount(s, v.Representative, nil)
+    if err != nil {
+        return false
+    }
+
+    verifier, err := rep.Verifier()
+    if err != nil {
+        return false
+    }
+
+    return verifier.Verify(v.Signature, voteMessage(v.TxHash)) == nil
+}
+
+// Weight delegated to every representative: the native balance of all
+// accounts delegating to it
+func RepresentativeWeights(s store.Store) (map[string]Amount, error) {
+    weights := make(map[string]Amount)
+    native := NativeCurrency().Ticker
+
+    addrs, err := ListAccounts(s)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, addr := range addrs {
+        acc, err := OpenAccount(s, addr, nil)
+        if err != nil {
+            return nil, err
+        }
+        if !acc.HasLedger(native) {
+            continue
+        }
+
+        led, err := acc.OpenLedger(native)
+        if err != nil {
+            return nil, err
+        }
+        if rep := led.Representative(); rep != "" {
+            weights[rep] = weights[rep].addCapped(led.Balance())
+        }
+    }
+
+    return weights, nil
+}
+
+// Check the confirmation status of a single tx
+func IsConfirmed(s store.Store, addr string, currency string, hash string) (bool, error) {
+    acc, err := OpenAccount(s, addr, nil)
+    if err != nil {
+        return false, err
+    }
+    if !acc.HasLedger(currency) {
+        return false, ErrLedgerNotFound
+    }
+
+    led, err := acc.OpenLedger(currency)
+    if err != nil {
+        return false, err
+    }
+
+    return led.IsConfirmed(hash), nil
+}
+
+// Votes collected for a single tx
+type Election struct {
+    TxHash      string
+    Address     string          // Account the tx belongs to, empty while we haven't seen the tx
+    Currency    string
+    Votes       map[string]Vote // By representative
+    Confirmed   bool
+    started     time.Time
+}
+
+// Collects votes and confirms txs once the votes pass the quorum
+type Tally struct {
+    store       store.Store
+    elections   map[string]*Election
+    online      map[string]time.Time // Last vote of every representative
+    weights     map[string]Amount
+    weightsAt   time.Time
+    mu          sync.Mutex
+}
+
+func NewTally(s store.Store) *Tally {
+    return &Tally{
+        store: s,
+        elections: make(map[string]*Election),
+        online: make(map[string]time.Time),
+    }
+}
+
+// Start collecting votes for tx; votes which arrived before the tx are kept
+func (t *Tally) Start(tx Transaction) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    e := t.election(tx.Hash)
+    e.Address = tx.AccountAddress()
+    e.Currency = tx.Currency.Ticker
+
+    t.check(e)
+}
+
+// Add a vote, returns whether it confirmed its tx
+func (t *Tally) AddVote(v Vote) bool {
+    if !v.Verify(t.store) {
+        return false
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    t.online[v.Representative] = time.Now()
+
+    e := t.election(v.TxHash)
+    if _, ok := e.Votes[v.Representative]; ok || e.Confirmed {
+        return false
+    }
+    e.Votes[v.Representative] = v
+
+    return t.check(e)
+}
+
+// Get the votes collected for a tx
+func (t *Tally) Election(hash string) (Election, bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    e, ok := t.elections[hash]
+    if !ok {
+        return Election{}, false
+    }
+
+    copied := *e
+    copied.Votes = make(map[string]Vote, len(e.Votes))
+    for rep, v := range e.Votes {
+        copied.Votes[rep] = v
+    }
+
+    return copied, true
+}
+
+// Total weight of the representatives which voted recently
+func (t *Tally) OnlineWeight() Amount {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    return t.onlineWeight()
+}
+
+// Get or create the election for hash, dropping elections which timed out
+func (t *Tally) election(hash string) *Election {
+    if e, ok := t.elections[hash]; ok {
+        return e
+    }
+
+    for h, e := range t.elections {
+        if time.Since(e.started) > electionTimeout {
+            delete(t.elections, h)
+        }
+    }
+
+    e := &Election{TxHash: hash, Votes: make(map[string]Vote), started: time.Now()}
+    t.elections[hash] = e
+
+    return e
+}
+
+// Confirm the tx of the election if its votes pass the quorum
+func (t *Tally) check(e *Election) bool {
+    if e.Confirmed || e.Address == "" {
+        return false
+    }
+
+    // Against all weight, not only that of who voted lately: otherwise a node
+    // which just started would confirm on the first vote it gets
+    total := t.delegatedWeight()
+    if total == 0 {
+        return false
+    }
+
+    var voted Amount
+    for rep := range e.Votes {
+        voted = voted.addCapped(t.weights[rep])
+    }
+
+    quorum := total/100*QuorumPercentage + total%100*QuorumPercentage/100 // Without overflowing
+    if voted == 0 || voted < quorum {
+        return false
+    }
+
+    acc, err := OpenAccount(t.store, e.Address, nil)
+    if err != nil || !acc.HasLedger(e.Currency) {
+        return false
+    }
+
+    led, err := acc.OpenLedger(e.Currency)
+    if err != nil {
+        return false
+    }
+    e.Confirmed = led.confirm(e.TxHash, &acc)
+
+    return e.Confirmed
+}
+
+// Scan the weights again once they're outdated
+func (t *Tally) refreshWeights() {
+    if t.weights == nil || time.Since(t.weightsAt) > weightRefreshInterval {
+        if weights, err := RepresentativeWeights(t.store); err == nil { // Keep the old weights when scanning fails
+            t.weights = weights
+            t.weightsAt = time.Now()
+        }
+    }
+}
+
+// Weight of all representatives, whether they're online or not
+func (t *Tally) delegatedWeight() Amount {
+    t.refreshWeights()
+
+    var weight Amount
+    for _, w := range t.weights {
+        weight = weight.addCapped(w)
+    }
+
+    return weight
+}
+
+func (t *Tally) onlineWeight() Amount {
+    t.refreshWeights()
+
+    var weight Amount
+    for rep, seen := range t.online {
+        if time.Since(seen) > onlineWindow {
+            delete(t.online, rep)
+            continue
+        }
+        weight = weight.addCapped(t.weights[rep])
+    }
+
+    return weight
+}
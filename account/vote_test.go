@@ -0,0 +1,59 @@
+package account
+
+import (
+	"strings"
+	"testing"
+)
+
+// A vote only counts for the tx it was cast on, however much of the hash
+// another tx shares with it
+func TestVoteOnlyVerifiesForItsHash(t *testing.T) {
+	f := newFixture(t)
+	kp, _ := f.funded(100)
+
+	hash := "0" + strings.Repeat("a", 60) + "1111"
+	v, err := NewVote(kp, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Verify(f.s) {
+		t.Fatal("vote doesn't verify")
+	}
+
+	for _, other := range []string{"0" + strings.Repeat("a", 60) + "2222", hash[:64]} {
+		forged := v
+		forged.TxHash = other
+		if forged.Verify(f.s) {
+			t.Errorf("vote for %s verifies for %s", hash, other)
+		}
+	}
+}
+
+// The first vote a node gets doesn't confirm a tx on its own, the quorum is
+// taken of all delegated weight
+func TestQuorumOfDelegatedWeight(t *testing.T) {
+	f := newFixture(t)
+	small, smallAcc := f.funded(40)
+	big, bigAcc := f.funded(60)
+	f.delegate(small, smallAcc)
+	tx := f.delegate(big, bigAcc)
+
+	tally := NewTally(f.s)
+	tally.Start(tx)
+
+	v, _ := NewVote(small, tx.Hash)
+	if tally.AddVote(v) {
+		t.Fatal("confirmed by 40% of the weight")
+	}
+	if tally.OnlineWeight() != 40 {
+		t.Fatal(tally.OnlineWeight())
+	}
+
+	v, _ = NewVote(big, tx.Hash)
+	if !tally.AddVote(v) {
+		t.Fatal("not confirmed by all weight")
+	}
+	if ok, err := IsConfirmed(f.s, bigAcc.Address, NativeCurrency().Ticker, tx.Hash); err != nil || !ok {
+		t.Fatal("ledger not confirmed", err)
+	}
+}
@@ -0,0 +1,37 @@
+package account
+
+import (
+    "github.com/thomasbeukema/dargent/address"
+    "github.com/thomasbeukema/dargent/store"
+)
+
+// Number of unused accounts in a row after which a scan stops
+const WalletGapLimit = 20
+
+// Find the accounts of type t derived from w which exist in the store. The
+// scan goes through the indexes in order and stops after gap unused ones in a
+// row; with gap <= 0 WalletGapLimit is used.
+func ScanWallet(s store.Store, w address.Wallet, t address.AccountType, gap int) ([]address.Signer, error) {
+    if gap <= 0 {
+        gap = WalletGapLimit
+    }
+
+    used := make([]address.Signer, 0)
+    unused := 0
+
+    for index := uint32(0); unused < gap; index++ {
+        signer, err := w.Derive(t, index)
+        if err != nil {
+            return nil, err
+        }
+
+        if AccountExists(s, signer.GetAddress()) {
+            used = append(used, signer)
+            unused = 0
+        } else {
+            unused++
+        }
+    }
+
+    return used, nil
+}
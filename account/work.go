@@ -0,0 +1,149 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/bits"
+	"sync"
+)
+
+// Proof of work against spam. A tx carries a nonce Work such that the SHA-256
+// of the nonce, as big-endian uint64, followed by the root of the tx starts
+// with at least difficulty zero bits. The root is PreviousHash, or the public
+// key in Origin for a CREATE, so work can be done before the tx is made and
+// isn't part of its hash or signature.
+const (
+	DefaultWorkDifficulty uint8 = 20 // About a million hashes
+	MaxWorkDifficulty uint8 = 64
+)
+
+// Difficulty txs of this process must meet; every node of a network should
+// use the same, raising it makes stored txs with less work invalid
+var (
+	workDifficulty = DefaultWorkDifficulty
+	workMu sync.RWMutex
+)
+
+func SetWorkDifficulty(d uint8) error {
+	if d > MaxWorkDifficulty {
+		return ErrInvalidDifficulty
+	}
+
+	workMu.Lock()
+	defer workMu.Unlock()
+	workDifficulty = d
+
+	return nil
+}
+
+func WorkDifficulty() uint8 {
+	workMu.RLock()
+	defer workMu.RUnlock()
+
+	return workDifficulty
+}
+
+// Bytes the work of tx is done over, nil when tx has no root
+func (tx *Transaction) WorkRoot() []byte {
+	if tx.Action == CREATE {
+		pubkey, err := base64.StdEncoding.DecodeString(tx.Origin)
+		if err != nil {
+			return nil
+		}
+		return pubkey
+	}
+	if tx.PreviousHash == "" {
+		return nil
+	}
+
+	return []byte(tx.PreviousHash)
+}
+
+// Number of leading zero bits of the hash of nonce and root
+func workBits(root []byte, nonce uint64) int {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], nonce)
+	hash := sha256.Sum256(append(b[:], root...))
+
+	n := 0
+	for i := 0; i < len(hash); i += 8 {
+		word := binary.BigEndian.Uint64(hash[i:])
+		n += bits.LeadingZeros64(word)
+		if word != 0 {
+			break
+		}
+	}
+
+	return n
+}
+
+// Check that nonce is work for root of at least difficulty
+func ValidWork(root []byte, nonce uint64, difficulty uint8) bool {
+	return root != nil && workBits(root, nonce) >= int(difficulty)
+}
+
+// Find a nonce that is work for root of difficulty, trying nonces on workers
+// goroutines until one is found or ctx is done
+func GenerateWork(ctx context.Context, root []byte, difficulty uint8, workers int) (uint64, error) {
+	if root == nil {
+		return 0, ErrInvalidTransaction
+	}
+	if difficulty > MaxWorkDifficulty {
+		return 0, ErrInvalidDifficulty
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := make(chan uint64, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(nonce uint64) { // Each worker tries every workers-th nonce
+			defer wg.Done()
+
+			for tries := 0; ; tries++ {
+				if tries%1024 == 0 && ctx.Err() != nil {
+					return
+				}
+				if workBits(root, nonce) >= int(difficulty) {
+					found <- nonce
+					return
+				}
+				nonce += uint64(workers)
+			}
+		}(uint64(i))
+	}
+
+	select {
+		case nonce := <-found:
+			cancel()
+			wg.Wait()
+			return nonce, nil
+		case <-ctx.Done():
+			wg.Wait()
+			select { // Found right as ctx was done
+				case nonce := <-found:
+					return nonce, nil
+				default:
+					return 0, ctx.Err()
+			}
+	}
+}
+
+// Do the work for tx at the current difficulty and store it in tx.Work; the
+// hash and signature of tx stay valid
+func (tx *Transaction) GenerateWork(ctx context.Context, workers int) error {
+	nonce, err := GenerateWork(ctx, tx.WorkRoot(), WorkDifficulty(), workers)
+	if err != nil {
+		return err
+	}
+	tx.Work = nonce
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"testing"
+	"time"
+
+	"github.com/thomasbeukema/dargent/address"
+)
+
+// Leading zero bits counted byte by byte, to check workBits against
+func leadingZeros(root []byte, nonce uint64) int {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], nonce)
+	hash := sha256.Sum256(append(b[:], root...))
+
+	n := 0
+	for _, x := range hash {
+		n += bits.LeadingZeros8(x)
+		if x != 0 {
+			break
+		}
+	}
+
+	return n
+}
+
+func TestWorkBits(t *testing.T) {
+	root := []byte("root")
+
+	best := uint64(0)
+	for nonce := uint64(0); nonce < 5000; nonce++ {
+		got := workBits(root, nonce)
+		if want := leadingZeros(root, nonce); got != want {
+			t.Fatalf("nonce %d: %d bits, want %d", nonce, got, want)
+		}
+		if got > workBits(root, best) {
+			best = nonce
+		}
+	}
+
+	n := workBits(root, best)
+	if n < 8 {
+		t.Fatalf("best of 5000 nonces has %d bits", n)
+	}
+	if !ValidWork(root, best, uint8(n)) || ValidWork(root, best, uint8(n+1)) {
+		t.Fatalf("nonce with %d bits", n)
+	}
+	if workBits([]byte("other"), best) == n && workBits([]byte("toor"), best) == n {
+		t.Fatal("work doesn't depend on the root")
+	}
+
+	if !ValidWork(root, 12345, 0) {
+		t.Fatal("every nonce is work for difficulty 0")
+	}
+	if ValidWork(nil, best, 0) {
+		t.Fatal("work without a root")
+	}
+}
+
+func TestGenerateWork(t *testing.T) {
+	root := []byte("root")
+
+	for _, workers := range []int{0, 1, 4} {
+		nonce, err := GenerateWork(context.Background(), root, 12, workers)
+		if err != nil {
+			t.Fatal(workers, err)
+		}
+		if !ValidWork(root, nonce, 12) {
+			t.Fatalf("%d workers: nonce %d has %d bits", workers, nonce, workBits(root, nonce))
+		}
+	}
+
+	if _, err := GenerateWork(context.Background(), nil, 12, 1); !errors.Is(err, ErrInvalidTransaction) {
+		t.Fatal(err)
+	}
+	if _, err := GenerateWork(context.Background(), root, MaxWorkDifficulty+1, 1); !errors.Is(err, ErrInvalidDifficulty) {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateWorkCancelled(t *testing.T) {
+	root := []byte("root")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GenerateWork(ctx, root, MaxWorkDifficulty, 4); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := GenerateWork(ctx, root, MaxWorkDifficulty, 4); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("workers kept going after the deadline", time.Since(start))
+	}
+}
+
+func TestVerifyChecksWork(t *testing.T) {
+	defer SetWorkDifficulty(0)
+	if err := SetWorkDifficulty(MaxWorkDifficulty + 1); !errors.Is(err, ErrInvalidDifficulty) {
+		t.Fatal(err)
+	}
+	if err := SetWorkDifficulty(12); err != nil {
+		t.Fatal(err)
+	}
+
+	kp, err := address.GenerateECCKeyPair(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := NewCreateTransaction(kp.PublicKey, kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := address.NewVerifier(address.TypeOfAddress(kp.GetAddress()), kp.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ValidWork(tx.WorkRoot(), tx.Work, 12) {
+		tx.Work++
+	}
+	if tx.Verify(v) {
+		t.Fatalf("tx with %d bits of work accepted", workBits(tx.WorkRoot(), tx.Work))
+	}
+
+	hash := tx.Hash
+	if err := tx.GenerateWork(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Verify(v) {
+		t.Fatal("tx with enough work rejected")
+	}
+	if tx.Hash != hash {
+		t.Fatal("work changed the hash")
+	}
+}
@@ -2,6 +2,7 @@ package address
 
 import (
     "crypto/sha256"
+    "errors"
 )
 
 const (
@@ -9,6 +10,15 @@ const (
 	checksumLength = 5
 )
 
+var (
+    ErrBadEncoding = errors.New("Invalid encoding")
+    ErrInvalidSignature = errors.New("Invalid signature")
+    ErrInvalidPublicKey = errors.New("Invalid public key")
+    ErrInvalidMnemonic = errors.New("Invalid mnemonic")
+    ErrInvalidEntropy = errors.New("Invalid entropy length")
+    ErrKeyGeneration = errors.New("Failed to generate key pair")
+)
+
 // padding for addresses
 var ecdsaPadding []byte = []byte{0xAA, 0xBB, 0xCC}
 var sphincsPadding []byte = []byte{0x00, 0x11, 0x22}
@@ -18,52 +28,48 @@ const (
     ECC AccountType = iota // 0
     SPHINCS // 1
     UNKNOWN
+    MULTISIG // 3, M of N keys of the types above; after UNKNOWN to keep its value
 )
 
-// TODO: Complete function
+// Check that address is well formed and its checksum matches
 func ValidateAddress(address string) bool {
-
-    if len(address) == 61 && address[:3] == "666" && address[len(address)-3:] == "999" { // ECDSA
-        validateECDSAAddress(address)
-    } else if len(address) == 61 && address[:3] == "999" && address[len(address)-3:] == "666" { // SPHINCS
-        validateSPHINCSAddress(address)
-    } else {
-        return false
-    }
-
-    return true
+    return Validate(address) == nil
 }
 
 func TypeOfAddress(address string) AccountType {
-    if len(address) == 61 && address[:3] == "666" && address[len(address)-3:] == "999" { // ECDSA
-        return ECC
-    } else if  len(address) == 61 && address[:3] == "999" && address[len(address)-3:] == "666" { // SPHINCS
-        return SPHINCS
-    } else {
+    _, t, err := Decode(address)
+    if err != nil {
         return UNKNOWN
     }
+
+    return t
 }
 
+// Find the registered scheme by the size or layout of its public keys
 func TypeOfPublicKey(publicKey []byte) AccountType {
-    if len(publicKey) == 64 { // ECDSA
-        return ECC
-    } else if len(publicKey) == 1056 { // SPHINCS
-        return SPHINCS
-    } else { // unknown or invalid
-        return UNKNOWN
+    algorithmsMu.RLock()
+    registered := make(map[AccountType]Algorithm, len(algorithms))
+    for t, a := range algorithms {
+        registered[t] = a
+    }
+    algorithmsMu.RUnlock() // IsPublicKey may look up schemes itself
+
+    for t, a := range registered {
+        if a.accepts(publicKey) {
+            return t
+        }
     }
+
+    return UNKNOWN // unknown or invalid
 }
 
 func PubKeyToAddress(pubkey []byte) string {
-    t := TypeOfPublicKey(pubkey)
-
-    if t == ECC {
-        return ECCPubKeyToAddress(pubkey)
-    } else if t == SPHINCS {
-        return SPHINCSPubKeyToAddress(pubkey)
-    } else {
+    v, err := NewVerifier(TypeOfPublicKey(pubkey), pubkey)
+    if err != nil {
         return ""
     }
+
+    return v.GetAddress()
 }
 
 // Generate hash for validation
@@ -0,0 +1,133 @@
+package address
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Bech32m (BIP-350) encoding: a human-readable part, the separator '1', and
+// the data in base32 followed by a 6 character checksum which detects any
+// error in up to 4 characters
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+    bech32mConst = 0x2bc830a3
+    bech32ChecksumLength = 6
+    bech32MaxLength = 90
+)
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+    chk := uint32(1)
+    for _, v := range values {
+        top := chk >> 25
+        chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+        for i := 0; i < 5; i++ {
+            if (top>>uint(i))&1 == 1 {
+                chk ^= bech32Generator[i]
+            }
+        }
+    }
+
+    return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+    expanded := make([]byte, 0, len(hrp)*2+1)
+    for i := 0; i < len(hrp); i++ {
+        expanded = append(expanded, hrp[i]>>5)
+    }
+    expanded = append(expanded, 0)
+    for i := 0; i < len(hrp); i++ {
+        expanded = append(expanded, hrp[i]&31)
+    }
+
+    return expanded
+}
+
+// Encode data, given in bytes, under the human-readable part hrp
+func bech32Encode(hrp string, data []byte) string {
+    values := convertBits(data, 8, 5, true)
+
+    checksumInput := append(append(bech32HRPExpand(hrp), values...), make([]byte, bech32ChecksumLength)...)
+    polymod := bech32Polymod(checksumInput) ^ bech32mConst
+
+    var b strings.Builder
+    b.WriteString(hrp)
+    b.WriteByte('1')
+    for _, v := range values {
+        b.WriteByte(bech32Charset[v])
+    }
+    for i := 0; i < bech32ChecksumLength; i++ {
+        b.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+    }
+
+    return b.String()
+}
+
+// Split s in its human-readable part and data, checking the checksum
+func bech32Decode(s string) (string, []byte, error) {
+    if len(s) > bech32MaxLength {
+        return "", nil, fmt.Errorf("%w: too long", ErrInvalidAddress)
+    }
+    if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+        return "", nil, fmt.Errorf("%w: mixed case", ErrBadEncoding)
+    }
+    s = strings.ToLower(s)
+
+    sep := strings.LastIndexByte(s, '1')
+    if sep < 1 || sep+1+bech32ChecksumLength > len(s) {
+        return "", nil, fmt.Errorf("%w: no separator", ErrInvalidAddress)
+    }
+    hrp := s[:sep]
+
+    values := make([]byte, 0, len(s)-sep-1)
+    for i := sep + 1; i < len(s); i++ {
+        v := strings.IndexByte(bech32Charset, s[i])
+        if v < 0 {
+            return "", nil, fmt.Errorf("%w: invalid character %q", ErrBadEncoding, s[i])
+        }
+        values = append(values, byte(v))
+    }
+
+    if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != bech32mConst {
+        return "", nil, ErrAddressChecksum
+    }
+
+    data := convertBits(values[:len(values)-bech32ChecksumLength], 5, 8, false)
+    if data == nil {
+        return "", nil, fmt.Errorf("%w: invalid padding", ErrBadEncoding)
+    }
+
+    return hrp, data, nil
+}
+
+// Regroup data of from-bit values into to-bit values. Without pad, leftover
+// bits must be zero and fewer than from; nil if they aren't.
+func convertBits(data []byte, from uint, to uint, pad bool) []byte {
+    var acc uint32
+    var bits uint
+    out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+    maxv := uint32(1)<<to - 1
+
+    for _, v := range data {
+        acc = acc<<from | uint32(v)
+        bits += from
+        for bits >= to {
+            bits -= to
+            out = append(out, byte((acc>>bits)&maxv))
+        }
+    }
+
+    if pad {
+        if bits > 0 {
+            out = append(out, byte((acc<<(to-bits))&maxv))
+        }
+    } else if bits >= from || (acc<<(to-bits))&maxv != 0 {
+        return nil
+    }
+
+    return out
+}
@@ -0,0 +1,188 @@
+package address
+
+import (
+    "crypto/sha256"
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+
+    "github.com/tyler-smith/go-bip39/wordlists"
+    "golang.org/x/text/unicode/norm"
+)
+
+var (
+    ErrUnknownWord = errors.New("Word not in the wordlist")
+    ErrBadChecksum = errors.New("Mnemonic checksum mismatch")
+    ErrBadWordCount = errors.New("Mnemonic must have 12, 15, 18, 21 or 24 words")
+    ErrUnknownLanguage = errors.New("Unknown mnemonic language")
+)
+
+// Wordlists of the BIP-39 specification, in the order languages are tried
+// when detecting the language of a phrase
+var bip39Languages = []struct {
+    name    string
+    words   []string
+}{
+    {"english", wordlists.English},
+    {"spanish", wordlists.Spanish},
+    {"french", wordlists.French},
+    {"italian", wordlists.Italian},
+    {"czech", wordlists.Czech},
+    {"japanese", wordlists.Japanese},
+    {"korean", wordlists.Korean},
+    {"chinese_simplified", wordlists.ChineseSimplified},
+    {"chinese_traditional", wordlists.ChineseTraditional},
+}
+
+// Position of every word, per language; built on first use
+var (
+    bip39Indexes map[string]map[string]int
+    bip39IndexOnce sync.Once
+)
+
+func bip39Index(language string) (map[string]int, bool) {
+    bip39IndexOnce.Do(func() {
+        bip39Indexes = make(map[string]map[string]int, len(bip39Languages))
+        for _, l := range bip39Languages {
+            index := make(map[string]int, len(l.words))
+            for i, w := range l.words {
+                index[norm.NFKD.String(w)] = i
+            }
+            bip39Indexes[l.name] = index
+        }
+    })
+
+    index, ok := bip39Indexes[language]
+    return index, ok
+}
+
+// Names of the languages EntropyToBIP39 can use
+func BIP39Languages() []string {
+    names := make([]string, len(bip39Languages))
+    for i, l := range bip39Languages {
+        names[i] = l.name
+    }
+
+    return names
+}
+
+// Encode entropy of 16, 20, 24, 28 or 32 bytes as a BIP-39 phrase
+func EntropyToBIP39(entropy []byte, language string) (string, error) {
+    if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+        return "", ErrInvalidEntropy
+    }
+
+    var words []string
+    for _, l := range bip39Languages {
+        if l.name == language {
+            words = l.words
+        }
+    }
+    if words == nil {
+        return "", ErrUnknownLanguage
+    }
+
+    checksum := sha256.Sum256(entropy)
+    bits := append(append([]byte{}, entropy...), checksum[0]) // The checksum is at most 8 bits
+    count := (len(entropy)*8 + len(entropy)/4) / 11
+
+    phrase := make([]string, count)
+    for i := range phrase {
+        phrase[i] = words[readBits(bits, i*11, 11)]
+    }
+
+    separator := " "
+    if language == "japanese" {
+        separator = "\u3000" // Ideographic space
+    }
+
+    return strings.Join(phrase, separator), nil
+}
+
+// Decode a BIP-39 phrase in any of the languages; returns the entropy and the
+// language it was in
+func BIP39ToEntropy(phrase string) ([]byte, string, error) {
+    words := bip39Words(phrase)
+    if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+        return nil, "", ErrBadWordCount
+    }
+
+    err := fmt.Errorf("%w: %q", ErrUnknownWord, words[0])
+    best := -1
+
+    for _, l := range bip39Languages {
+        index, _ := bip39Index(l.name)
+
+        indexes := make([]int, len(words))
+        known := 0
+        for i, w := range words {
+            position, ok := index[w]
+            if !ok {
+                break
+            }
+            indexes[i] = position
+            known++
+        }
+
+        if known < len(words) { // Report the unknown word of the closest language
+            if known > best {
+                best = known
+                err = fmt.Errorf("%w: %q", ErrUnknownWord, words[known])
+            }
+            continue
+        }
+
+        entropy, ok := decodeBIP39(indexes)
+        if ok {
+            return entropy, l.name, nil
+        }
+        best, err = len(words), ErrBadChecksum // Languages share words, keep looking
+    }
+
+    return nil, "", err
+}
+
+// Split phrase into words in the form the spec compares them in, NFKD, so
+// accented words typed precomposed are found too
+func bip39Words(phrase string) []string {
+    return strings.Fields(norm.NFKD.String(phrase))
+}
+
+// Turn word positions into entropy, checking the checksum
+func decodeBIP39(indexes []int) ([]byte, bool) {
+    total := len(indexes) * 11
+    checksumBits := total / 33
+    bits := make([]byte, (total+7)/8)
+
+    for i, position := range indexes {
+        writeBits(bits, i*11, 11, position)
+    }
+
+    entropy := bits[:(total-checksumBits)/8]
+    checksum := sha256.Sum256(entropy)
+
+    got := readBits(bits, total-checksumBits, checksumBits)
+    want := int(checksum[0] >> uint(8-checksumBits))
+
+    return append([]byte{}, entropy...), got == want
+}
+
+// Read n bits starting at bit offset of b, most significant first
+func readBits(b []byte, offset int, n int) int {
+    v := 0
+    for i := offset; i < offset+n; i++ {
+        v = v<<1 | int(b[i/8]>>uint(7-i%8)&1)
+    }
+
+    return v
+}
+
+// Write the lowest n bits of v at bit offset of b
+func writeBits(b []byte, offset int, n int, v int) {
+    for i := 0; i < n; i++ {
+        if v>>uint(n-1-i)&1 == 1 {
+            b[(offset+i)/8] |= 1 << uint(7-(offset+i)%8)
+        }
+    }
+}
@@ -0,0 +1,132 @@
+package address
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// English vectors of the BIP-39 reference implementation, without passphrase
+var bip39Vectors = []struct {
+	entropy	string
+	phrase	string
+}{
+	{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+	{"80808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage above"},
+	{"ffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"},
+	{"000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon agent"},
+	{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal will"},
+	{"0000000000000000000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"},
+	{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote"},
+	{"9e885d952ad362caeb4efe34a8e91bd2", "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic"},
+	{"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c", "hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length"},
+	{"f585c11aec520db57dd353c69554b21a89b20fb0650966fa0a9d6f74fd989d8f", "void come effort suffer camp survey warrior heavy shoot primary clutch crush open amazing screen patrol group space point ten exist slush involve unfold"},
+}
+
+func TestBIP39Vectors(t *testing.T) {
+	for _, v := range bip39Vectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+
+		phrase, err := EntropyToBIP39(entropy, "english")
+		if err != nil || phrase != v.phrase {
+			t.Errorf("%s: %q, %v; want %q", v.entropy, phrase, err, v.phrase)
+		}
+
+		decoded, language, err := BIP39ToEntropy(v.phrase)
+		if err != nil || language != "english" || !bytes.Equal(decoded, entropy) {
+			t.Errorf("%q: %x, %s, %v", v.phrase, decoded, language, err)
+		}
+	}
+}
+
+func TestBIP39Errors(t *testing.T) {
+	valid := bip39Vectors[0].phrase
+
+	if _, _, err := BIP39ToEntropy(strings.Repeat("abandon ", 12)); !errors.Is(err, ErrBadChecksum) {
+		t.Error("bad checksum:", err)
+	}
+	if _, _, err := BIP39ToEntropy(strings.Replace(valid, "about", "xyzzy", 1)); !errors.Is(err, ErrUnknownWord) || !strings.Contains(err.Error(), "xyzzy") {
+		t.Error("unknown word:", err)
+	}
+	if _, _, err := BIP39ToEntropy(strings.TrimSuffix(valid, " about")); !errors.Is(err, ErrBadWordCount) {
+		t.Error("11 words:", err)
+	}
+	if _, _, err := BIP39ToEntropy(valid + " " + valid + " " + valid); !errors.Is(err, ErrBadWordCount) {
+		t.Error("36 words:", err)
+	}
+
+	if _, err := EntropyToBIP39(make([]byte, 16), "klingon"); !errors.Is(err, ErrUnknownLanguage) {
+		t.Error("unknown language:", err)
+	}
+	for _, size := range []int{12, 18, 36} {
+		if _, err := EntropyToBIP39(make([]byte, size), "english"); !errors.Is(err, ErrInvalidEntropy) {
+			t.Errorf("%d bytes: %v", size, err)
+		}
+	}
+}
+
+func TestBIP39Languages(t *testing.T) {
+	entropy, _ := hex.DecodeString(bip39Vectors[9].entropy)
+
+	for _, language := range BIP39Languages() {
+		phrase, err := EntropyToBIP39(entropy, language)
+		if err != nil {
+			t.Fatal(language, err)
+		}
+
+		decoded, _, err := BIP39ToEntropy(phrase)
+		if err != nil || !bytes.Equal(decoded, entropy) {
+			t.Errorf("%s: %x, %v", language, decoded, err)
+		}
+	}
+}
+
+// The wordlists are NFKD, but accents typed on a keyboard are usually
+// precomposed
+func TestBIP39Normalizes(t *testing.T) {
+	entropy, _ := hex.DecodeString(bip39Vectors[10].entropy)
+
+	for _, language := range []string{"spanish", "french", "japanese"} {
+		phrase, err := EntropyToBIP39(entropy, language)
+		if err != nil {
+			t.Fatal(err)
+		}
+		composed := norm.NFC.String(phrase)
+		if composed == phrase {
+			t.Fatalf("%s: phrase without decomposed characters", language)
+		}
+
+		decoded, got, err := BIP39ToEntropy(composed)
+		if err != nil || got != language || !bytes.Equal(decoded, entropy) {
+			t.Errorf("%s: %x, %s, %v", language, decoded, got, err)
+		}
+		if DetectMnemonic(composed) != BIP39 {
+			t.Errorf("%s: not detected as BIP-39", language)
+		}
+	}
+}
+
+func TestDetectMnemonic(t *testing.T) {
+	tests := []struct {
+		phrase	string
+		want	MnemonicFlavour
+	}{
+		{bip39Vectors[0].phrase, BIP39},
+		{bip39Vectors[7].phrase, BIP39},
+		{strings.Repeat("abandon ", 12), BIP39}, // Bad checksum, but a BIP-39 phrase still
+		{strings.ToUpper(bip39Vectors[1].phrase), NEBULOUS},
+		{getMnemonic(make([]byte, 32)), NEBULOUS},
+		{"", NEBULOUS},
+	}
+
+	for _, test := range tests {
+		if got := DetectMnemonic(test.phrase); got != test.want {
+			t.Errorf("%q: %d, want %d", test.phrase, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package address
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/mr-tron/base58/base58"
+)
+
+var (
+    ErrInvalidAddress = errors.New("Invalid address")
+    ErrAddressChecksum = errors.New("Address checksum mismatch")
+)
+
+// Addresses are bech32m strings (see bech32.go): the human-readable part of
+// the network, e.g. "dar1..." on mainnet, and as data a version byte (see
+// versionByte) followed by the SHA-256 of the public key.
+//
+// Legacy addresses, which are still decoded but no longer made, look like
+// <prefix> base58(payload) base58(checksum) <suffix>, where payload is the
+// SHA-256 of the public key followed by the padding of the account type, and
+// checksum the first bytes of SHA-256(SHA-256(SHA-256(payload))). Both base58
+// parts vary in length, so the split between them is found by decoding.
+// They carry no network and are accepted on every network.
+type addressFormat struct {
+    prefix      string
+    suffix      string
+    padding     []byte
+}
+
+var addressFormats = map[AccountType]addressFormat{
+    ECC: {"666", "999", ecdsaPadding},
+    SPHINCS: {"999", "666", sphincsPadding},
+}
+
+const (
+    payloadLength = sha256Length + 3 // Hash of the key and the padding
+    sha256Length = 32
+    // Longest base58 encodings of the payload and the checksum
+    maxPayloadChars = 48
+    maxChecksumChars = 7
+)
+
+// What an address holds
+type Parsed struct {
+    Network     Network // Meaningless for legacy addresses
+    Type        AccountType
+    KeyHash     []byte // SHA-256 of the public key
+    Legacy      bool
+}
+
+// Make the address of pubkey on the current network, using the scheme its
+// length belongs to
+func Encode(pubkey []byte) (string, error) {
+    t := TypeOfPublicKey(pubkey)
+    if t == UNKNOWN {
+        return "", ErrInvalidPublicKey
+    }
+
+    return encodeAddress(CurrentNetwork(), t, HashPubKey(pubkey))
+}
+
+// Make the legacy address of pubkey, for finding what was stored under it
+func EncodeLegacy(pubkey []byte) (string, error) {
+    t := TypeOfPublicKey(pubkey)
+    if t == UNKNOWN {
+        return "", ErrInvalidPublicKey
+    }
+
+    return encodeLegacyAddress(t, HashPubKey(pubkey))
+}
+
+func encodeAddress(n Network, t AccountType, keyHash []byte) (string, error) {
+    hrp, ok := networkHRPs[n]
+    if !ok {
+        return "", ErrUnknownNetwork
+    }
+    if _, ok := LookupAlgorithm(t); !ok {
+        return "", ErrUnknownAlgorithm
+    }
+
+    data := append([]byte{versionByte(n, t)}, keyHash...)
+
+    return bech32Encode(hrp, data), nil
+}
+
+func encodeLegacyAddress(t AccountType, keyHash []byte) (string, error) {
+    f, ok := addressFormats[t]
+    if !ok {
+        return "", ErrUnknownAlgorithm
+    }
+
+    payload := append(append([]byte{}, keyHash...), f.padding...)
+
+    b58Payload := base58.Encode(payload)
+    b58Checksum := base58.Encode(generateChecksum(HashPubKey(payload)))
+
+    return f.prefix + b58Payload + b58Checksum + f.suffix, nil
+}
+
+// Read an address of any network, in either format
+func Parse(address string) (Parsed, error) {
+    for n, hrp := range networkHRPs {
+        if !strings.HasPrefix(strings.ToLower(address), hrp+"1") {
+            continue
+        }
+
+        return parseBech32(address, n)
+    }
+
+    for t, f := range addressFormats {
+        if len(address) < len(f.prefix)+len(f.suffix) || !strings.HasPrefix(address, f.prefix) || !strings.HasSuffix(address, f.suffix) {
+            continue
+        }
+
+        keyHash, err := decodeBody(address[len(f.prefix):len(address)-len(f.suffix)], f)
+        if err != nil {
+            return Parsed{}, err
+        }
+
+        return Parsed{Type: t, KeyHash: keyHash, Legacy: true}, nil
+    }
+
+    return Parsed{}, ErrInvalidAddress
+}
+
+func parseBech32(address string, n Network) (Parsed, error) {
+    hrp, data, err := bech32Decode(address)
+    if err != nil {
+        return Parsed{}, err
+    }
+    if hrp != networkHRPs[n] || len(data) != 1+sha256Length {
+        return Parsed{}, fmt.Errorf("%w: wrong length", ErrInvalidAddress)
+    }
+
+    versionNetwork, t := splitVersion(data[0])
+    if versionNetwork != n {
+        return Parsed{}, fmt.Errorf("%w: version byte doesn't match the prefix", ErrInvalidAddress)
+    }
+    if _, ok := LookupAlgorithm(t); !ok {
+        return Parsed{}, ErrUnknownAlgorithm
+    }
+
+    return Parsed{Network: n, Type: t, KeyHash: data[1:]}, nil
+}
+
+// Get the hash of the public key and the account type out of an address,
+// which must be legacy or for the current network
+func Decode(address string) ([]byte, AccountType, error) {
+    p, err := Parse(address)
+    if err != nil {
+        return nil, UNKNOWN, err
+    }
+    if !p.Legacy && p.Network != CurrentNetwork() {
+        return nil, UNKNOWN, fmt.Errorf("%w: %s", ErrWrongNetwork, p.Network)
+    }
+
+    return p.KeyHash, p.Type, nil
+}
+
+// Split the part between prefix and suffix into payload and checksum
+func decodeBody(body string, f addressFormat) ([]byte, error) {
+    if len(body) < 2 || len(body) > maxPayloadChars+maxChecksumChars {
+        return nil, fmt.Errorf("%w: wrong length", ErrInvalidAddress)
+    }
+    if _, err := base58.Decode(body); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrBadEncoding, err)
+    }
+
+    err := fmt.Errorf("%w: wrong length", ErrInvalidAddress)
+    for split := len(body) - 1; split > 0 && len(body)-split <= maxChecksumChars; split-- {
+        payload, decodeErr := base58.Decode(body[:split])
+        if decodeErr != nil || len(payload) != payloadLength || !bytes.HasSuffix(payload, f.padding) {
+            continue
+        }
+
+        checksum, decodeErr := base58.Decode(body[split:])
+        if decodeErr != nil || !bytes.Equal(checksum, generateChecksum(HashPubKey(payload))) {
+            err = ErrAddressChecksum
+            continue
+        }
+
+        return payload[:sha256Length], nil
+    }
+
+    return nil, err
+}
+
+// Check that address is well formed, its checksum matches and it may be used
+// on the current network
+func Validate(address string) error {
+    _, _, err := Decode(address)
+    return err
+}
+
+// Check whether a and b are addresses of the same key, whichever network
+// or format they are written for
+func SameKey(a, b string) bool {
+    pa, err := Parse(a)
+    if err != nil {
+        return false
+    }
+    pb, err := Parse(b)
+    if err != nil {
+        return false
+    }
+
+    return pa.Type == pb.Type && bytes.Equal(pa.KeyHash, pb.KeyHash)
+}
+
+// Give the address in the form it's stored under: legacy addresses are
+// turned into ones of the current network
+func Normalize(address string) (string, error) {
+    keyHash, t, err := Decode(address)
+    if err != nil {
+        return "", err
+    }
+
+    return encodeAddress(CurrentNetwork(), t, keyHash)
+}
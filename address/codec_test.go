@@ -0,0 +1,136 @@
+package address
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Keys of both schemes from reproducible entropy
+func randomKeys(t *testing.T, r *rand.Rand, count int) [][]byte {
+	keys := make([][]byte, 0, count)
+
+	for i := 0; i < count; i++ {
+		entropy := make([]byte, 32)
+		r.Read(entropy)
+
+		var kp Signer
+		var err error
+		if i%8 == 7 { // SPHINCS keys are slow to make
+			kp, err = GenerateSPHINCSKeyPair(entropy)
+		} else {
+			kp, err = GenerateECCKeyPair(entropy)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, kp.GetPublicKey())
+	}
+
+	return keys
+}
+
+// Whatever is encoded decodes to the same key, in both formats
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for _, pubkey := range randomKeys(t, r, 64) {
+		addr, err := Encode(pubkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy, err := EncodeLegacy(pubkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, a := range []string{addr, legacy, strings.ToUpper(addr)} {
+			keyHash, typ, err := Decode(a)
+			if err != nil {
+				t.Fatalf("%s: %v", a, err)
+			}
+			if typ != TypeOfPublicKey(pubkey) || !bytes.Equal(keyHash, HashPubKey(pubkey)) {
+				t.Fatalf("%s decodes to another key", a)
+			}
+		}
+
+		if normalized, err := Normalize(legacy); err != nil || normalized != addr {
+			t.Fatalf("normalized %s to %s, want %s, %v", legacy, normalized, addr, err)
+		}
+		if !SameKey(addr, legacy) {
+			t.Fatalf("%s and %s not the same key", addr, legacy)
+		}
+	}
+}
+
+// Every change to a single character of an address is caught
+func TestDecodeRejectsCorruption(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+
+	for _, pubkey := range randomKeys(t, r, 16) {
+		addr, _ := Encode(pubkey)
+		legacy, _ := EncodeLegacy(pubkey)
+
+		for _, c := range []struct {
+			addr	string
+			from	int // Characters before this are the prefix
+			to		int // and from here on the suffix
+			charset	string
+		}{
+			{addr, len(networkHRPs[MAINNET]) + 1, len(addr), bech32Charset},
+			{legacy, 3, len(legacy) - 3, "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"},
+		} {
+			for i := c.from; i < c.to; i++ {
+				replacement := c.charset[r.Intn(len(c.charset))]
+				if replacement == c.addr[i] {
+					continue
+				}
+
+				corrupt := c.addr[:i] + string(replacement) + c.addr[i+1:]
+				if _, _, err := Decode(corrupt); err == nil {
+					t.Fatalf("%s accepted, corrupted from %s", corrupt, c.addr)
+				}
+			}
+		}
+
+		for name, corrupt := range map[string]string{
+			"bad base58": legacy[:10] + "0" + legacy[11:],
+			"bad bech32": addr[:10] + "b" + addr[11:],
+			"short": addr[:len(addr)-1],
+			"long": addr[:len(addr)-6] + "q" + addr[len(addr)-6:],
+			"short legacy": legacy[:8] + legacy[9:],
+			"long legacy": legacy[:8] + "2" + legacy[8:],
+			"mixed case": addr[:10] + strings.ToUpper(addr[10:]),
+			"no body": "666999",
+		} {
+			if _, _, err := Decode(corrupt); err == nil {
+				t.Fatalf("%s: %s accepted", name, corrupt)
+			}
+		}
+	}
+}
+
+func TestDecodeOtherNetwork(t *testing.T) {
+	kp, _ := GenerateECCKeyPair(make([]byte, 32))
+	mainnet := kp.GetAddress()
+	legacy, _ := EncodeLegacy(kp.PublicKey)
+
+	if err := SetNetwork(TESTNET); err != nil {
+		t.Fatal(err)
+	}
+	defer SetNetwork(MAINNET)
+
+	if _, _, err := Decode(mainnet); !errors.Is(err, ErrWrongNetwork) {
+		t.Fatalf("mainnet address on testnet: got %v, want ErrWrongNetwork", err)
+	}
+	if _, _, err := Decode(legacy); err != nil { // Legacy addresses have no network
+		t.Fatal(err)
+	}
+
+	addr, _ := Encode(kp.PublicKey)
+	if !strings.HasPrefix(addr, "tdar1") || !SameKey(addr, mainnet) {
+		t.Fatal(addr)
+	}
+}
@@ -0,0 +1,120 @@
+package address
+
+import (
+    "crypto/elliptic"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/binary"
+    "math/big"
+
+    "github.com/thomasbeukema/fastrand"
+)
+
+// Keys are derived from the 32 bytes of entropy a mnemonic encodes, so the
+// same phrase always restores the same address.
+//
+// ECC: the private scalar is HMAC-SHA256(key "dargent/ecc", entropy || c) for
+// the first counter byte c = 0, 1, ... which gives a value in [1, N-1] of
+// P-256. Both coordinates of the public key are padded to 32 bytes.
+//
+// SPHINCS: sphincs256.GenerateKey reads its randomness from the blocks
+// HMAC-SHA256(key "dargent/sphincs", entropy || i), i a big-endian uint32
+// counting from 0.
+//
+// Known answers, entropy in hex:
+//
+//   00...00 (32 zero bytes)
+//     ECC scalar       51f7b27a3e912bc2a8c42c673447abbc37b18a74be66a8bd2b7774120cce7bac
+//     ECC address      dar1qzacyfss04cwfd24p2chlfzlqwvnkeq4335cqgz0h6xafwayy0q2kww9yvh (mainnet)
+//     legacy address   666Ki9zsQbQTfcxWetLcM3yxwC9gLsCvGnrNxwPhLs6ipyHpPcoM8pLKM6999
+//     SPHINCS block 0  930565c136c28a14aff5d86af5112b8c3fa2c5a8914419ee9e3d26cebdee07e8
+//   000102...1f
+//     ECC scalar       125aa035c5ecf4024a37df058d09cc8c0cb8473117ae7a772fa3a3ad187a1f41
+//     ECC address      dar1qqn0x4nkycshqx65mq6yxryes4k2kn2l5c6wxh453cn7052s2jmwg4k6440 (mainnet)
+//     legacy address   6664tR89HTz1JEDT6mi19GMxd3QD8dLPnjpD22vt2DB3v3voAM1HLq6se4999
+const (
+    eccDerivationKey = "dargent/ecc"
+    sphincsDerivationKey = "dargent/sphincs"
+)
+
+// Use ent as the entropy of a new key pair, or fresh entropy if it's nil
+func entropyFrom(ent []byte) ([32]byte, error) {
+    var entropy [32]byte
+
+    if ent == nil {
+        fastrand.New()
+        return fastrand.GetEntropy(), nil
+    }
+    if len(ent) > len(entropy) {
+        return entropy, ErrInvalidEntropy
+    }
+
+    copy(entropy[:], ent)
+    return entropy, nil
+}
+
+// Private scalar of the ECC key for entropy
+func deriveECCScalar(entropy [32]byte) *big.Int {
+    n := elliptic.P256().Params().N
+    one := big.NewInt(1)
+
+    for c := 0; ; c++ { // Only fails to land in range with a chance of about 2^-32
+        mac := hmac.New(sha256.New, []byte(eccDerivationKey))
+        mac.Write(entropy[:])
+        mac.Write([]byte{byte(c)})
+
+        d := new(big.Int).SetBytes(mac.Sum(nil))
+        if d.Cmp(one) >= 0 && d.Cmp(n) < 0 {
+            return d
+        }
+    }
+}
+
+// Endless stream of bytes derived from entropy, for key generation which
+// wants an io.Reader
+type deriveReader struct {
+    key         []byte
+    entropy     [32]byte
+    counter     uint32
+    buffer      []byte
+}
+
+func newDeriveReader(key string, entropy [32]byte) *deriveReader {
+    return &deriveReader{key: []byte(key), entropy: entropy}
+}
+
+func (r *deriveReader) Read(p []byte) (int, error) {
+    for n := 0; n < len(p); {
+        if len(r.buffer) == 0 {
+            var counter [4]byte
+            binary.BigEndian.PutUint32(counter[:], r.counter)
+            r.counter++
+
+            mac := hmac.New(sha256.New, r.key)
+            mac.Write(r.entropy[:])
+            mac.Write(counter[:])
+            r.buffer = mac.Sum(nil)
+        }
+
+        copied := copy(p[n:], r.buffer)
+        r.buffer = r.buffer[copied:]
+        n += copied
+    }
+
+    return len(p), nil
+}
+
+// Restore the key pair of type t a mnemonic was made for
+func RestoreFromMnemonic(phrase string, t AccountType) (Signer, error) {
+    entropy, err := MnemonicToEntropy(phrase)
+    if err != nil {
+        return nil, err
+    }
+
+    a, ok := LookupAlgorithm(t)
+    if !ok || a.NewKeyPair == nil {
+        return nil, ErrUnknownAlgorithm
+    }
+
+    return a.NewKeyPair(entropy[:])
+}
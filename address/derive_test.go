@@ -0,0 +1,133 @@
+package address
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Known answers from the doc comment of derive.go; a wallet restored on any
+// version has to come to the same keys
+var derivationVectors = []struct {
+	entropy	[]byte
+	scalar	string
+	address	string
+	legacy	string
+}{
+	{
+		make([]byte, 32),
+		"51f7b27a3e912bc2a8c42c673447abbc37b18a74be66a8bd2b7774120cce7bac",
+		"dar1qzacyfss04cwfd24p2chlfzlqwvnkeq4335cqgz0h6xafwayy0q2kww9yvh",
+		"666Ki9zsQbQTfcxWetLcM3yxwC9gLsCvGnrNxwPhLs6ipyHpPcoM8pLKM6999",
+	},
+	{
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+			0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+		},
+		"125aa035c5ecf4024a37df058d09cc8c0cb8473117ae7a772fa3a3ad187a1f41",
+		"dar1qqn0x4nkycshqx65mq6yxryes4k2kn2l5c6wxh453cn7052s2jmwg4k6440",
+		"6664tR89HTz1JEDT6mi19GMxd3QD8dLPnjpD22vt2DB3v3voAM1HLq6se4999",
+	},
+}
+
+func TestDeriveECCKnownAnswers(t *testing.T) {
+	if CurrentNetwork() != MAINNET {
+		t.Fatal("vectors are for mainnet")
+	}
+
+	for _, v := range derivationVectors {
+		kp, err := GenerateECCKeyPair(v.entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := hex.EncodeToString(kp.PrivateKey.D.FillBytes(make([]byte, 32))); got != v.scalar {
+			t.Errorf("scalar %s, want %s", got, v.scalar)
+		}
+		if got := kp.GetAddress(); got != v.address {
+			t.Errorf("address %s, want %s", got, v.address)
+		}
+		if got, err := EncodeLegacy(kp.PublicKey); err != nil || got != v.legacy {
+			t.Errorf("legacy address %s, want %s, %v", got, v.legacy, err)
+		}
+	}
+}
+
+func TestDeriveSPHINCSRandomness(t *testing.T) {
+	r := newDeriveReader(sphincsDerivationKey, [32]byte{})
+
+	block := make([]byte, 32)
+	r.Read(block)
+	if got := hex.EncodeToString(block); got != "930565c136c28a14aff5d86af5112b8c3fa2c5a8914419ee9e3d26cebdee07e8" {
+		t.Fatalf("block 0 %s", got)
+	}
+
+	// Reads of any size continue the same stream
+	whole := make([]byte, 100)
+	newDeriveReader(sphincsDerivationKey, [32]byte{}).Read(whole)
+	split := make([]byte, 100)
+	r = newDeriveReader(sphincsDerivationKey, [32]byte{})
+	r.Read(split[:7])
+	r.Read(split[7:70])
+	r.Read(split[70:])
+	if !bytes.Equal(whole, split) {
+		t.Fatal("stream depends on read sizes")
+	}
+}
+
+func TestSPHINCSDeterministic(t *testing.T) {
+	entropy := derivationVectors[1].entropy
+
+	a, err := GenerateSPHINCSKeyPair(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSPHINCSKeyPair(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.GetPublicKey(), b.GetPublicKey()) || a.GetAddress() != b.GetAddress() {
+		t.Fatal("same entropy gave different keys")
+	}
+
+	c, err := GenerateSPHINCSKeyPair(derivationVectors[0].entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a.GetPublicKey(), c.GetPublicKey()) {
+		t.Fatal("other entropy gave the same key")
+	}
+}
+
+func TestRestoreFromMnemonic(t *testing.T) {
+	ecc, _ := GenerateECCKeyPair(derivationVectors[1].entropy)
+	sphincs, _ := GenerateSPHINCSKeyPair(derivationVectors[1].entropy)
+
+	bip39, err := EntropyToBIP39(derivationVectors[1].entropy, "english")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		phrase	string
+		t		AccountType
+		want	string
+	}{
+		{ecc.Mnemonic(), ECC, ecc.GetAddress()},
+		{sphincs.Mnemonic(), SPHINCS, sphincs.GetAddress()},
+		{bip39, ECC, derivationVectors[1].address},
+	} {
+		restored, err := RestoreFromMnemonic(c.phrase, c.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.GetAddress() != c.want {
+			t.Errorf("restored %s, want %s", restored.GetAddress(), c.want)
+		}
+	}
+
+	if _, err := RestoreFromMnemonic(ecc.Mnemonic(), UNKNOWN); err == nil {
+		t.Fatal("restored a key of an unknown type")
+	}
+}
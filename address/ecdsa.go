@@ -4,64 +4,74 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"fmt"
 	"math/big"
-
-	"github.com/mr-tron/base58/base58"
-	"github.com/thomasbeukema/fastrand"
 )
 
-// Struct to hold ECC Keys
-type ECCKeyPair struct {
-	PrivateKey	ecdsa.PrivateKey
-	PublicKey	[]byte
-	Entropy		*[32]byte
+func init() {
+	RegisterAlgorithm(ECC, Algorithm{
+		Name: "ecdsa-p256",
+		PublicKeySize: 64,
+		NewVerifier: func(pubkey []byte) (Verifier, error) {
+			return ECCPublicKey(pubkey), nil
+		},
+		NewKeyPair: func(entropy []byte) (Signer, error) {
+			return GenerateECCKeyPair(entropy)
+		},
+	})
 }
 
-// Generate new KeyPair (new address)
-func GenerateECCKeyPair(ent []byte) ECCKeyPair {
-
-	fastrand.New()
-	var entropy [32]byte
+// Public key of an ECC account; X and Y of the point
+type ECCPublicKey []byte
 
-	if ent != nil {
-		for i := range ent {
-			entropy[i] = ent[i]
-		}
-	} else {
-		entropy = fastrand.GetEntropy()
-	}
+func (pk ECCPublicKey) GetAddress() string {
+	return ECCPubKeyToAddress(pk)
+}
 
-	curve := elliptic.P256() // Init the curve we're using
-	private, err := ecdsa.GenerateKey(curve, fastrand.Reader) // Generate address from own seed
-	if err != nil {
-		panic(1)
-	}
-	public := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...) // Derive public key from private key
-	return ECCKeyPair{*private, public, &entropy}
+func (pk ECCPublicKey) GetPublicKey() []byte {
+	return pk
 }
 
-func ECCPubKeyToAddress(pubkey []byte) string {
-    pubkey = append(HashPubKey(pubkey), ecdsaPadding...)
+func (pk ECCPublicKey) Algorithm() AccountType {
+	return ECC
+}
 
-    b32Pubkey := base58.Encode(pubkey)                                 // Generate Base58 of public key
-    b32Checksum := base58.Encode(generateChecksum(HashPubKey(pubkey))) // Get checksum for the public key and generate Base32 of it
+func (pk ECCPublicKey) Verify(sig string, message []byte) error {
+	return ValidateECCSignature(sig, message, pk)
+}
 
-    return "666" + b32Pubkey + b32Checksum + "999"
+// Struct to hold ECC Keys
+type ECCKeyPair struct {
+	PrivateKey	ecdsa.PrivateKey
+	PublicKey	[]byte
+	Entropy		*[32]byte
 }
 
-func validateECDSAAddress(address string) bool {
+// Generate new KeyPair (new address), derived from ent or from fresh
+// entropy when it's nil; see derive.go
+func GenerateECCKeyPair(ent []byte) (ECCKeyPair, error) {
+	entropy, err := entropyFrom(ent)
+	if err != nil {
+		return ECCKeyPair{}, err
+	}
 
-    if address[:3] != "666" || address[len(address)-3:] != "999" {
-        return false
-    }
+	curve := elliptic.P256() // Init the curve we're using
+	d := deriveECCScalar(entropy)
+	x, y := curve.ScalarBaseMult(d.FillBytes(make([]byte, 32)))
+	private := ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
 
-    address = address[3:len(address)-3] // Strip '666' & '999'
+	public := make([]byte, 64) // Derive public key from private key, X and Y padded to 32 bytes
+	x.FillBytes(public[:32])
+	y.FillBytes(public[32:])
 
-    checksum := address[len(address)-8:]
-    generatedChecksum := base58.Encode(generateChecksum([]byte(address[:len(address)-8])))
+	return ECCKeyPair{private, public, &entropy}, nil
+}
 
-    return checksum == generatedChecksum
+func ECCPubKeyToAddress(pubkey []byte) string {
+    addr, _ := encodeAddress(CurrentNetwork(), ECC, HashPubKey(pubkey))
+    return addr
 }
 
 // Get address from public key
@@ -69,32 +79,65 @@ func (kp ECCKeyPair) GetAddress() string {
 	return ECCPubKeyToAddress(kp.PublicKey)
 }
 
-func (kp *ECCKeyPair) Mnemonic() string {
+func (kp ECCKeyPair) GetPublicKey() []byte {
+	return kp.PublicKey
+}
+
+func (kp ECCKeyPair) Algorithm() AccountType {
+	return ECC
+}
+
+// Entropy the key pair was derived from
+func (kp ECCKeyPair) GetEntropy() []byte {
+	return kp.Entropy[:]
+}
+
+func (kp ECCKeyPair) Mnemonic() string {
 	return getMnemonic(kp.Entropy[:])
 }
 
-// Check if an address is actually valid
+// Check if an address is a valid ECC address
+//
+// Deprecated: use Decode, which also tells why an address is invalid
 func ValidateECCAddress(address string) bool {
-	address = address[3 : len(address)-3]                                                  // Remove the '666' prefix and '999' appendix
-	checksum := address[len(address)-8:]                                                       // Extract already generated checksum
-	decodedPubkey, _ := base58.Decode(address[:len(address)-8])                    // Extract en decode public key from address
-	targetChecksum := base58.Encode(generateChecksum(HashPubKey(decodedPubkey))) // Generate new checksum to see if there hasn't been tampered with
-	return checksum == targetChecksum
+	_, t, err := Decode(address)
+	return err == nil && t == ECC
+}
+
+// Sign the SHA-256 of message with private key; ECDSA only looks at as many
+// bytes as the curve is long, which would leave most of a tx hash unsigned
+func (kp ECCKeyPair) Sign(message []byte) (string, error) {
+	digest := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(rand.Reader, &kp.PrivateKey, digest[:]) // Sign the hash
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64) // Both parts padded to 32 bytes, so the signature always has the same length
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return base64.StdEncoding.EncodeToString(signature), nil // Return the base64 encoded signature
 }
 
-// Sign with private key
-func (kp ECCKeyPair) Sign(hash []byte) string {
-	// TODO: Error checking
-	r, s, _ := ecdsa.Sign(rand.Reader, &kp.PrivateKey, hash) // Sign the hash
-	signature := append(r.Bytes(), s.Bytes()...)             // Append both parts to get 1 signature
-	return base64.StdEncoding.EncodeToString(signature)      // Return the base64 encoded signature
+// Check a signature made with this key pair
+func (kp ECCKeyPair) Verify(sig string, message []byte) error {
+	return ValidateECCSignature(sig, message, kp.PublicKey)
 }
 
-func ValidateECCSignature(sig string, hash []byte, pubkey []byte) bool {
+// Check sig is a signature of the SHA-256 of message by pubkey, see Sign
+func ValidateECCSignature(sig string, message []byte, pubkey []byte) error {
 	curve := elliptic.P256() // Init curve
 
-	signatureBytes, _ := base64.StdEncoding.DecodeString(sig) // Extract signature
+	signatureBytes, err := base64.StdEncoding.DecodeString(sig) // Extract signature
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadEncoding, err)
+	}
 	signatureLength := len(signatureBytes)
+	if signatureLength == 0 {
+		return ErrInvalidSignature
+	}
+	if len(pubkey) == 0 {
+		return ErrInvalidPublicKey
+	}
 
 	r := big.Int{} // Parse signature in 2 parts
 	s := big.Int{}
@@ -109,10 +152,11 @@ func ValidateECCSignature(sig string, hash []byte, pubkey []byte) bool {
 	x.SetBytes(pubkey[:(keyLength/2)])
 	y.SetBytes(pubkey[(keyLength/2):])
 
-	rawPubKey := ecdsa.PublicKey{curve, &x, &y} // Init public key for verification
-	if ecdsa.Verify(&rawPubKey, hash, &r, &s) == false {
-		return false
+	rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y} // Init public key for verification
+	digest := sha256.Sum256(message)
+	if ecdsa.Verify(&rawPubKey, digest[:], &r, &s) == false {
+		return ErrInvalidSignature
 	}
 
-	return true
+	return nil
 }
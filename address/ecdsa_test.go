@@ -0,0 +1,33 @@
+package address
+
+import (
+	"strings"
+	"testing"
+)
+
+// A tx hash is longer than the curve; all of it has to be signed
+func TestECCSignsWholeMessage(t *testing.T) {
+	kp, err := GenerateECCKeyPair(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := "0" + strings.Repeat("a", 60) + "1111"
+	sig, err := kp.Sign([]byte(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ECCPublicKey(kp.PublicKey).Verify(sig, []byte(hash)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, other := range []string{
+		"0" + strings.Repeat("a", 60) + "2222", // Differs past the 32nd byte
+		hash[:64],
+		hash + "0",
+	} {
+		if ValidateECCSignature(sig, []byte(other), kp.PublicKey) == nil {
+			t.Errorf("signature of %s verifies for %s", hash, other)
+		}
+	}
+}
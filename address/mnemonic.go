@@ -1,23 +1,82 @@
 package address
 
 import (
+    "errors"
+    "fmt"
+
     "github.com/NebulousLabs/entropy-mnemonics"
 )
 
+// Kinds of phrases MnemonicToEntropy understands
+type MnemonicFlavour int
+const (
+    NEBULOUS MnemonicFlavour = iota // 0, what Mnemonic() gives
+    BIP39 // 1
+)
+
 // Generate new seed and mnemonic
 func getMnemonic(key []byte) string {
     phrase, _ := mnemonics.ToPhrase(key, mnemonics.English)
     return phrase.String()
 }
 
-func MnemonicToEntropy(phrase string) [32]byte {
-    ent, _ := mnemonics.FromString(phrase, mnemonics.English)
+// Tell which flavour phrase is. A phrase made only of words of one BIP-39
+// wordlist is taken as BIP-39, anything else as a Nebulous phrase.
+func DetectMnemonic(phrase string) MnemonicFlavour {
+    _, _, err := BIP39ToEntropy(phrase)
+    if err == nil || errors.Is(err, ErrBadChecksum) {
+        return BIP39
+    }
 
+    return NEBULOUS
+}
+
+// Get the entropy a phrase of either flavour encodes. BIP-39 phrases shorter
+// than 24 words give less than 32 bytes, the rest is left zero.
+func MnemonicToEntropy(phrase string) ([32]byte, error) {
     var ent32 [32]byte
 
+    bip39Entropy, _, bip39Err := BIP39ToEntropy(phrase)
+    if bip39Err == nil {
+        copy(ent32[:], bip39Entropy)
+        return ent32, nil
+    }
+
+    ent, err := mnemonics.FromString(phrase, mnemonics.English)
+    if err != nil {
+        if errors.Is(bip39Err, ErrBadChecksum) || looksLikeBIP39(phrase) { // Say what's wrong with it as BIP-39
+            return ent32, fmt.Errorf("%w: %v", ErrInvalidMnemonic, bip39Err)
+        }
+        return ent32, fmt.Errorf("%w: %v", ErrInvalidMnemonic, err)
+    }
+    if len(ent) > len(ent32) {
+        return ent32, ErrInvalidMnemonic
+    }
+
     for i := range ent {
         ent32[i] = ent[i]
     }
 
-    return ent32
+    return ent32, nil
+}
+
+// Check whether most words of phrase are in a BIP-39 wordlist
+func looksLikeBIP39(phrase string) bool {
+    words := bip39Words(phrase)
+
+    for _, l := range bip39Languages {
+        index, _ := bip39Index(l.name)
+
+        known := 0
+        for _, w := range words {
+            if _, ok := index[w]; ok {
+                known++
+            }
+        }
+        if known*2 > len(words) {
+            return true
+        }
+    }
+
+    return false
 }
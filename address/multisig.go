@@ -0,0 +1,301 @@
+package address
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "sort"
+)
+
+var (
+    ErrNotCosigner = errors.New("Key is not a cosigner of the multisig account")
+    ErrNotEnoughSignatures = errors.New("Not enough cosigners signed")
+)
+
+// Most cosigners a multisig account can have
+const MaxCosigners = 16
+
+const multisigTag = 0x4D // 'M', first byte of every multisig public key
+
+func init() {
+    RegisterAlgorithm(MULTISIG, Algorithm{
+        Name: "multisig",
+        IsPublicKey: func(pubkey []byte) bool {
+            _, err := ParseMultisigKey(pubkey)
+            return err == nil
+        },
+        NewVerifier: func(pubkey []byte) (Verifier, error) {
+            return ParseMultisigKey(pubkey)
+        },
+    })
+}
+
+// Public key of an M-of-N account: valid signatures need Threshold of the
+// Cosigners to sign. The public key, and so the address, commits to both:
+//
+//   'M' || M || N || N times (type || big-endian uint16 length || key)
+//
+// with the cosigners sorted by type and then by key, so the order they're
+// given in doesn't change the address.
+type MultisigKey struct {
+    Threshold   int
+    Cosigners   []Verifier
+}
+
+// Make the key of an account needing threshold of the cosigners to sign;
+// cosigners can be of any single-key type, mixed
+func NewMultisigKey(threshold int, cosigners ...Verifier) (MultisigKey, error) {
+    if len(cosigners) == 0 || len(cosigners) > MaxCosigners {
+        return MultisigKey{}, fmt.Errorf("%w: need 1 to %d cosigners", ErrInvalidPublicKey, MaxCosigners)
+    }
+    if threshold < 1 || threshold > len(cosigners) {
+        return MultisigKey{}, fmt.Errorf("%w: threshold %d of %d cosigners", ErrInvalidPublicKey, threshold, len(cosigners))
+    }
+
+    key := MultisigKey{Threshold: threshold, Cosigners: make([]Verifier, 0, len(cosigners))}
+    for _, c := range cosigners {
+        if c.Algorithm() == MULTISIG {
+            return MultisigKey{}, fmt.Errorf("%w: multisig accounts can't be nested", ErrInvalidPublicKey)
+        }
+
+        v, err := NewVerifier(c.Algorithm(), c.GetPublicKey()) // Don't hold on to private keys
+        if err != nil {
+            return MultisigKey{}, err
+        }
+        key.Cosigners = append(key.Cosigners, v)
+    }
+
+    sort.Slice(key.Cosigners, func(i, j int) bool {
+        return lessCosigner(key.Cosigners[i], key.Cosigners[j])
+    })
+    for i := 1; i < len(key.Cosigners); i++ {
+        if !lessCosigner(key.Cosigners[i-1], key.Cosigners[i]) {
+            return MultisigKey{}, fmt.Errorf("%w: duplicate cosigner", ErrInvalidPublicKey)
+        }
+    }
+
+    return key, nil
+}
+
+func lessCosigner(a Verifier, b Verifier) bool {
+    if a.Algorithm() != b.Algorithm() {
+        return a.Algorithm() < b.Algorithm()
+    }
+
+    return bytes.Compare(a.GetPublicKey(), b.GetPublicKey()) < 0
+}
+
+// Read a public key made by MultisigKey.GetPublicKey
+func ParseMultisigKey(pubkey []byte) (MultisigKey, error) {
+    if len(pubkey) < 3 || pubkey[0] != multisigTag {
+        return MultisigKey{}, ErrInvalidPublicKey
+    }
+
+    threshold, n := int(pubkey[1]), int(pubkey[2])
+    rest := pubkey[3:]
+
+    cosigners := make([]Verifier, 0, n)
+    for i := 0; i < n; i++ {
+        if len(rest) < 3 {
+            return MultisigKey{}, ErrInvalidPublicKey
+        }
+
+        t := AccountType(rest[0])
+        size := int(binary.BigEndian.Uint16(rest[1:3]))
+        if t == MULTISIG || len(rest) < 3+size {
+            return MultisigKey{}, ErrInvalidPublicKey
+        }
+
+        v, err := NewVerifier(t, rest[3:3+size])
+        if err != nil {
+            return MultisigKey{}, err
+        }
+        cosigners = append(cosigners, v)
+        rest = rest[3+size:]
+    }
+    if len(rest) != 0 {
+        return MultisigKey{}, ErrInvalidPublicKey
+    }
+
+    key, err := NewMultisigKey(threshold, cosigners...)
+    if err != nil {
+        return MultisigKey{}, err
+    }
+    if !bytes.Equal(key.GetPublicKey(), pubkey) { // Not in canonical order
+        return MultisigKey{}, ErrInvalidPublicKey
+    }
+
+    return key, nil
+}
+
+func (key MultisigKey) GetPublicKey() []byte {
+    pubkey := []byte{multisigTag, byte(key.Threshold), byte(len(key.Cosigners))}
+    for _, c := range key.Cosigners {
+        var size [2]byte
+        binary.BigEndian.PutUint16(size[:], uint16(len(c.GetPublicKey())))
+
+        pubkey = append(pubkey, byte(c.Algorithm()))
+        pubkey = append(pubkey, size[:]...)
+        pubkey = append(pubkey, c.GetPublicKey()...)
+    }
+
+    return pubkey
+}
+
+func (key MultisigKey) GetAddress() string {
+    addr, _ := encodeAddress(CurrentNetwork(), MULTISIG, HashPubKey(key.GetPublicKey()))
+    return addr
+}
+
+func (key MultisigKey) Algorithm() AccountType {
+    return MULTISIG
+}
+
+// Position of the cosigner with pubkey, -1 if there's none
+func (key MultisigKey) IndexOf(pubkey []byte) int {
+    for i, c := range key.Cosigners {
+        if bytes.Equal(c.GetPublicKey(), pubkey) {
+            return i
+        }
+    }
+
+    return -1
+}
+
+// Check that sig, a bundle made by Combine, holds valid signatures of hash by
+// at least Threshold different cosigners
+func (key MultisigKey) Verify(sig string, hash []byte) error {
+    parts, err := DecodeSignatureBundle(sig)
+    if err != nil {
+        return err
+    }
+
+    if valid := key.validPartials(hash, parts); len(valid) < key.Threshold {
+        return fmt.Errorf("%w: %v", ErrInvalidSignature, ErrNotEnoughSignatures)
+    }
+
+    return nil
+}
+
+// Signature of one cosigner, made offline and combined later
+type PartialSignature struct {
+    Index       int     `json:"i"` // Of the cosigner in MultisigKey.Cosigners
+    Signature   string  `json:"s"`
+}
+
+// Sign hash as one of the cosigners
+func (key MultisigKey) SignPartial(signer Signer, hash []byte) (PartialSignature, error) {
+    i := key.IndexOf(signer.GetPublicKey())
+    if i < 0 || key.Cosigners[i].Algorithm() != signer.Algorithm() {
+        return PartialSignature{}, ErrNotCosigner
+    }
+
+    sig, err := signer.Sign(hash)
+    if err != nil {
+        return PartialSignature{}, err
+    }
+
+    return PartialSignature{Index: i, Signature: sig}, nil
+}
+
+// Bundle the partial signatures of hash into the signature of the account.
+// Invalid and duplicate partials are dropped; only Threshold are kept.
+func (key MultisigKey) Combine(hash []byte, parts ...PartialSignature) (string, error) {
+    valid := key.validPartials(hash, parts)
+    if len(valid) < key.Threshold {
+        return "", fmt.Errorf("%w: %d of %d", ErrNotEnoughSignatures, len(valid), key.Threshold)
+    }
+
+    return EncodeSignatureBundle(valid[:key.Threshold])
+}
+
+// Partials of different cosigners which are valid for hash, by index
+func (key MultisigKey) validPartials(hash []byte, parts []PartialSignature) []PartialSignature {
+    seen := make(map[int]bool)
+    valid := make([]PartialSignature, 0, len(parts))
+
+    for _, p := range parts {
+        if p.Index < 0 || p.Index >= len(key.Cosigners) || seen[p.Index] {
+            continue
+        }
+        if key.Cosigners[p.Index].Verify(p.Signature, hash) != nil {
+            continue
+        }
+
+        seen[p.Index] = true
+        valid = append(valid, p)
+    }
+
+    sort.Slice(valid, func(i, j int) bool {
+        return valid[i].Index < valid[j].Index
+    })
+
+    return valid
+}
+
+// Signature of a multisig account: base64 of the partials, each as
+//
+//   index (1 byte) || big-endian uint32 length || raw signature
+//
+// so a bundle grows by the size of its signatures and little else, which
+// matters for SPHINCS cosigners
+func EncodeSignatureBundle(parts []PartialSignature) (string, error) {
+    var raw []byte
+
+    for _, p := range parts {
+        if p.Index < 0 || p.Index >= MaxCosigners {
+            return "", fmt.Errorf("%w: cosigner %d", ErrInvalidSignature, p.Index)
+        }
+        sig, err := base64.StdEncoding.DecodeString(p.Signature)
+        if err != nil {
+            return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+        }
+
+        var size [4]byte
+        binary.BigEndian.PutUint32(size[:], uint32(len(sig)))
+        raw = append(append(append(raw, byte(p.Index)), size[:]...), sig...)
+    }
+
+    return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func DecodeSignatureBundle(sig string) ([]PartialSignature, error) {
+    raw, err := base64.StdEncoding.DecodeString(sig)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+    }
+
+    parts := make([]PartialSignature, 0)
+    for len(raw) > 0 {
+        if len(raw) < 5 || len(parts) == MaxCosigners {
+            return nil, fmt.Errorf("%w: malformed bundle", ErrInvalidSignature)
+        }
+
+        size := binary.BigEndian.Uint32(raw[1:5])
+        if uint64(size) > uint64(len(raw)-5) {
+            return nil, fmt.Errorf("%w: malformed bundle", ErrInvalidSignature)
+        }
+
+        parts = append(parts, PartialSignature{
+            Index: int(raw[0]),
+            Signature: base64.StdEncoding.EncodeToString(raw[5:5+size]),
+        })
+        raw = raw[5+size:]
+    }
+
+    return parts, nil
+}
+
+// Signer for a multisig account out of partial signatures gathered from the
+// cosigners, e.g. to pass to Transaction.Sign once enough have signed. The
+// partials must be of the hash being signed.
+type Cosigned struct {
+    MultisigKey
+    Partials    []PartialSignature
+}
+
+func (c Cosigned) Sign(hash []byte) (string, error) {
+    return c.Combine(hash, c.Partials...)
+}
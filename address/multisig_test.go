@@ -0,0 +1,85 @@
+package address
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestSignatureBundleWithSPHINCS(t *testing.T) {
+	ecc, err := GenerateECCKeyPair(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sphincs, err := GenerateSPHINCSKeyPair(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewMultisigKey(2, ecc, sphincs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := []byte("hash")
+	var parts []PartialSignature
+	for _, signer := range []Signer{sphincs, ecc} {
+		p, err := key.SignPartial(signer, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, p)
+	}
+
+	sig, err := key.Combine(hash, parts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Verify(sig, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// Raw signatures plus 5 bytes each, in base64
+	raw := 0
+	for _, p := range parts {
+		b, _ := base64.StdEncoding.DecodeString(p.Signature)
+		raw += len(b) + 5
+	}
+	if len(sig) != base64.StdEncoding.EncodedLen(raw) {
+		t.Fatalf("bundle of %d bytes for %d bytes of signatures", len(sig), raw)
+	}
+
+	decoded, err := DecodeSignatureBundle(sig)
+	if err != nil || len(decoded) != 2 {
+		t.Fatalf("decoded %d partials: %v", len(decoded), err)
+	}
+	want := make(map[int]string)
+	for _, p := range parts {
+		want[p.Index] = p.Signature
+	}
+	for _, p := range decoded {
+		if p.Signature != want[p.Index] {
+			t.Fatalf("partial %d changed", p.Index)
+		}
+	}
+
+	if err := key.Verify(sig, []byte("other")); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("other hash: %v", err)
+	}
+}
+
+func TestDecodeMalformedBundle(t *testing.T) {
+	for _, raw := range [][]byte{
+		{0},
+		{0, 0, 0, 0, 9, 1, 2},
+		{0, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, err := DecodeSignatureBundle(base64.StdEncoding.EncodeToString(raw)); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%x: %v", raw, err)
+		}
+	}
+
+	if _, err := DecodeSignatureBundle("not base64!"); !errors.Is(err, ErrInvalidSignature) {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,88 @@
+package address
+
+import (
+    "errors"
+    "sync"
+)
+
+var (
+    ErrUnknownNetwork = errors.New("Unknown network")
+    ErrWrongNetwork = errors.New("Address belongs to another network")
+)
+
+// Network an address is meant for, so coins of one network can't be sent to
+// an address of another
+type Network uint8
+const (
+    MAINNET Network = iota // 0
+    TESTNET // 1
+    REGTEST // 2
+)
+
+// Human-readable part of the addresses of every network
+var networkHRPs = map[Network]string{
+    MAINNET: "dar",
+    TESTNET: "tdar",
+    REGTEST: "rdar",
+}
+
+var networkNames = map[Network]string{
+    MAINNET: "mainnet",
+    TESTNET: "testnet",
+    REGTEST: "regtest",
+}
+
+func (n Network) String() string {
+    if name, ok := networkNames[n]; ok {
+        return name
+    }
+
+    return "unknown"
+}
+
+// Find a network by the name String gives
+func ParseNetwork(name string) (Network, error) {
+    for n, s := range networkNames {
+        if s == name {
+            return n, nil
+        }
+    }
+
+    return 0, ErrUnknownNetwork
+}
+
+// Network this process works on; addresses are made for it and addresses of
+// other networks are rejected
+var (
+    network = MAINNET
+    networkMu sync.RWMutex
+)
+
+func SetNetwork(n Network) error {
+    if _, ok := networkHRPs[n]; !ok {
+        return ErrUnknownNetwork
+    }
+
+    networkMu.Lock()
+    defer networkMu.Unlock()
+    network = n
+
+    return nil
+}
+
+func CurrentNetwork() Network {
+    networkMu.RLock()
+    defer networkMu.RUnlock()
+
+    return network
+}
+
+// The version byte at the start of an address: network in the high nibble,
+// AccountType of the key in the low one
+func versionByte(n Network, t AccountType) byte {
+    return byte(n)<<4 | byte(t)&0x0F
+}
+
+func splitVersion(v byte) (Network, AccountType) {
+    return Network(v >> 4), AccountType(v & 0x0F)
+}
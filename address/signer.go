@@ -0,0 +1,74 @@
+package address
+
+import (
+    "errors"
+    "sync"
+)
+
+var ErrUnknownAlgorithm = errors.New("Unknown signature algorithm")
+
+// Public key of an account, which can check signatures made for it
+type Verifier interface {
+    GetAddress() string
+    GetPublicKey() []byte
+    Algorithm() AccountType
+    Verify(sig string, hash []byte) error // nil when sig is a valid signature of hash
+}
+
+// Key pair of an account, which can also make signatures
+type Signer interface {
+    Verifier
+    Sign(hash []byte) (string, error)
+}
+
+// Signature scheme, registered under the AccountType it's the tag of
+type Algorithm struct {
+    Name            string
+    PublicKeySize   int // 0 when keys vary in size, IsPublicKey tells them apart then
+    IsPublicKey     func(pubkey []byte) bool
+    NewVerifier     func(pubkey []byte) (Verifier, error)
+    NewKeyPair      func(entropy []byte) (Signer, error) // Deterministic for the same entropy
+}
+
+var (
+    algorithms = make(map[AccountType]Algorithm)
+    algorithmsMu sync.RWMutex
+)
+
+// Make a scheme available under tag t; done by every scheme in its init
+func RegisterAlgorithm(t AccountType, a Algorithm) {
+    algorithmsMu.Lock()
+    algorithms[t] = a
+    algorithmsMu.Unlock()
+}
+
+// Get the scheme registered under tag t
+func LookupAlgorithm(t AccountType) (Algorithm, bool) {
+    algorithmsMu.RLock()
+    defer algorithmsMu.RUnlock()
+
+    a, ok := algorithms[t]
+    return a, ok
+}
+
+// Get a Verifier for pubkey using the scheme tagged t
+func NewVerifier(t AccountType, pubkey []byte) (Verifier, error) {
+    a, ok := LookupAlgorithm(t)
+    if !ok {
+        return nil, ErrUnknownAlgorithm
+    }
+    if !a.accepts(pubkey) {
+        return nil, ErrInvalidPublicKey
+    }
+
+    return a.NewVerifier(pubkey)
+}
+
+// Check whether pubkey looks like a key of this scheme
+func (a Algorithm) accepts(pubkey []byte) bool {
+    if a.IsPublicKey != nil {
+        return a.IsPublicKey(pubkey)
+    }
+
+    return len(pubkey) == a.PublicKeySize
+}
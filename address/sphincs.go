@@ -2,91 +2,126 @@ package address
 
 import (
     "encoding/base64"
+    "fmt"
 
     "github.com/Yawning/sphincs256"
-    "github.com/mr-tron/base58/base58"
-    "github.com/thomasbeukema/fastrand"
 )
 
-type SPHINCSKeyPair struct {
-	PrivateKey	*[sphincs256.PrivateKeySize]byte
-	PublicKey	*[sphincs256.PublicKeySize]byte
-    Entropy     *[32]byte
+func init() {
+    RegisterAlgorithm(SPHINCS, Algorithm{
+        Name: "sphincs-256",
+        PublicKeySize: sphincs256.PublicKeySize,
+        NewVerifier: func(pubkey []byte) (Verifier, error) {
+            return SPHINCSPublicKey(pubkey), nil
+        },
+        NewKeyPair: func(entropy []byte) (Signer, error) {
+            return GenerateSPHINCSKeyPair(entropy)
+        },
+    })
 }
 
-func GenerateSPHINCSKeyPair(ent []byte) SPHINCSKeyPair {
+// Public key of a SPHINCS account
+type SPHINCSPublicKey []byte
 
-    fastrand.New()
+func (pk SPHINCSPublicKey) GetAddress() string {
+    return SPHINCSPubKeyToAddress(pk)
+}
 
-    var entropy [32]byte
+func (pk SPHINCSPublicKey) GetPublicKey() []byte {
+    return pk
+}
 
-    if ent != nil {
-        for i := range ent {
-            entropy[i] = ent[i]
-        }
+func (pk SPHINCSPublicKey) Algorithm() AccountType {
+    return SPHINCS
+}
 
-        fastrand.SetEntropy(entropy)
-    } else {
-        entropy = fastrand.GetEntropy()
+func (pk SPHINCSPublicKey) Verify(sig string, hash []byte) error {
+    var pubkey [sphincs256.PublicKeySize]byte
+    if len(pk) != len(pubkey) {
+        return ErrInvalidPublicKey
     }
+    copy(pubkey[:], pk)
+
+    return ValidateSPHINCSSignature(sig, hash, &pubkey)
+}
+
+type SPHINCSKeyPair struct {
+	PrivateKey	*[sphincs256.PrivateKeySize]byte
+	PublicKey	*[sphincs256.PublicKeySize]byte
+    Entropy     *[32]byte
+}
 
-	pub, priv, err := sphincs256.GenerateKey(fastrand.Reader)
+// Generate new KeyPair, derived from ent or from fresh entropy when it's nil;
+// see derive.go
+func GenerateSPHINCSKeyPair(ent []byte) (SPHINCSKeyPair, error) {
+    entropy, err := entropyFrom(ent)
+    if err != nil {
+        return SPHINCSKeyPair{}, err
+    }
+
+	pub, priv, err := sphincs256.GenerateKey(newDeriveReader(sphincsDerivationKey, entropy))
 	if err != nil {
-		panic(1)
+		return SPHINCSKeyPair{}, fmt.Errorf("%w: %v", ErrKeyGeneration, err)
 	}
 
-	return SPHINCSKeyPair{priv, pub, &entropy}
+	return SPHINCSKeyPair{priv, pub, &entropy}, nil
 }
 
 func SPHINCSPubKeyToAddress(pubkey []byte) string {
-    pubkey = append(HashPubKey(pubkey), sphincsPadding...)
-
-    b32Pubkey := base58.Encode(pubkey)                                 // Generate Base32 of public key
-    b32Checksum := base58.Encode(generateChecksum(HashPubKey(pubkey))) // Get checksum for the public key and generate Base32 of it
+    addr, _ := encodeAddress(CurrentNetwork(), SPHINCS, HashPubKey(pubkey))
+    return addr
+}
 
-    return "999" + b32Pubkey + b32Checksum + "666"
+// Entropy the key pair was derived from
+func (kp SPHINCSKeyPair) GetEntropy() []byte {
+    return kp.Entropy[:]
 }
 
-func (kp *SPHINCSKeyPair) Mnemonic() string {
+func (kp SPHINCSKeyPair) Mnemonic() string {
     return getMnemonic(kp.Entropy[:])
 }
 
-func validateSPHINCSAddress(address string) bool {
-
-    if address[:3] != "999" || address[len(address)-3:] != "666" {
-        return false
-    }
-
-    address = address[3:len(address)-3] // Strip '999' & '666'
-
-    checksum := address[len(address)-8:]
-    generatedChecksum := base58.Encode(generateChecksum([]byte(address[:len(address)-8])))
+func (kp SPHINCSKeyPair) GetAddress() string {
+    return SPHINCSPubKeyToAddress((*kp.PublicKey)[:])
+}
 
-    return checksum == generatedChecksum
+func (kp SPHINCSKeyPair) GetPublicKey() []byte {
+    return (*kp.PublicKey)[:]
 }
 
-func (kp *SPHINCSKeyPair) GetAddress() string {
-    return SPHINCSPubKeyToAddress((*kp.PublicKey)[:])
+func (kp SPHINCSKeyPair) Algorithm() AccountType {
+    return SPHINCS
 }
 
-func (kp *SPHINCSKeyPair) Sign(hash []byte) string {
+// Signing can't fail, the error is there to match ECCKeyPair.Sign
+func (kp SPHINCSKeyPair) Sign(hash []byte) (string, error) {
     signature := sphincs256.Sign(kp.PrivateKey, hash)
     b64sig := base64.StdEncoding.EncodeToString(signature[:])
 
-    return b64sig
+    return b64sig, nil
 }
 
-func ValidateSPHINCSSignature(sig string, hash []byte, pubkey *[1056]byte) bool {
+// Check a signature made with this key pair
+func (kp SPHINCSKeyPair) Verify(sig string, hash []byte) error {
+    return ValidateSPHINCSSignature(sig, hash, kp.PublicKey)
+}
+
+// Check sig of hash, returns nil when it was made by the owner of pubkey
+func ValidateSPHINCSSignature(sig string, hash []byte, pubkey *[sphincs256.PublicKeySize]byte) error {
     rawSig, err := base64.StdEncoding.DecodeString(sig)
     if err != nil {
-        // TODO: Proper err handling
-        panic(err)
+        return fmt.Errorf("%w: %v", ErrBadEncoding, err)
+    }
+
+    var finalSig [sphincs256.SignatureSize]byte
+    if len(rawSig) != len(finalSig) {
+        return ErrInvalidSignature
     }
+    copy(finalSig[:], rawSig)
 
-    var finalSig [41000]byte
-    for i := range rawSig {
-        finalSig[i] = rawSig[i]
+    if !sphincs256.Verify(pubkey, hash, &finalSig) {
+        return ErrInvalidSignature
     }
 
-    return sphincs256.Verify(pubkey, hash, &finalSig)
+    return nil
 }
@@ -0,0 +1,80 @@
+package address
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/binary"
+)
+
+const walletDerivationKey = "dargent/wallet"
+
+// Seed deriving an indexed sequence of accounts of every type. Account index
+// of type t uses the entropy HMAC-SHA256(key "dargent/wallet", seed || t ||
+// index), t and index as big-endian uint32, which goes through the same
+// derivation as a single key pair (see derive.go).
+type Wallet struct {
+    seed    [32]byte
+}
+
+// Create a wallet from seed, or from fresh entropy when it's nil
+func NewWallet(seed []byte) (Wallet, error) {
+    entropy, err := entropyFrom(seed)
+    if err != nil {
+        return Wallet{}, err
+    }
+
+    return Wallet{entropy}, nil
+}
+
+// Restore the wallet a mnemonic was made for
+func WalletFromMnemonic(phrase string) (Wallet, error) {
+    entropy, err := MnemonicToEntropy(phrase)
+    if err != nil {
+        return Wallet{}, err
+    }
+
+    return Wallet{entropy}, nil
+}
+
+// Phrase restoring the whole wallet
+func (w Wallet) Mnemonic() string {
+    return getMnemonic(w.seed[:])
+}
+
+// Entropy of account index of type t
+func (w Wallet) childEntropy(t AccountType, index uint32) [32]byte {
+    var path [8]byte
+    binary.BigEndian.PutUint32(path[:4], uint32(t))
+    binary.BigEndian.PutUint32(path[4:], index)
+
+    mac := hmac.New(sha256.New, []byte(walletDerivationKey))
+    mac.Write(w.seed[:])
+    mac.Write(path[:])
+
+    var entropy [32]byte
+    copy(entropy[:], mac.Sum(nil))
+
+    return entropy
+}
+
+// Derive the key pair of account index of type t
+func (w Wallet) Derive(t AccountType, index uint32) (Signer, error) {
+    a, ok := LookupAlgorithm(t)
+    if !ok || a.NewKeyPair == nil {
+        return nil, ErrUnknownAlgorithm
+    }
+
+    entropy := w.childEntropy(t, index)
+    return a.NewKeyPair(entropy[:])
+}
+
+// Export a single account as a phrase; RestoreFromMnemonic with the same t
+// gives its key pair without revealing the rest of the wallet
+func (w Wallet) Export(t AccountType, index uint32) (string, error) {
+    if _, ok := LookupAlgorithm(t); !ok {
+        return "", ErrUnknownAlgorithm
+    }
+
+    entropy := w.childEntropy(t, index)
+    return getMnemonic(entropy[:]), nil
+}
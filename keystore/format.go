@@ -0,0 +1,110 @@
+package keystore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/thomasbeukema/dargent/address"
+)
+
+// Version of the key files written by this keystore. Files of older versions
+// are upgraded when read; Migrate rewrites them in this version.
+const Version = 1
+
+const saltSize = 32
+
+// Cost of deriving the encryption key from a passphrase
+type ScryptParams struct {
+	N		int		`json:"n"`
+	R		int		`json:"r"`
+	P		int		`json:"p"`
+	Salt	[]byte	`json:"salt,omitempty"`
+}
+
+// Takes around 100ms and 32MB on a desktop
+var DefaultScryptParams = ScryptParams{N: 1 << 15, R: 8, P: 1}
+
+// Most costly parameters a key file may ask for, since they're read before
+// the passphrase can be checked: 1GB and a few minutes at most
+const (
+	maxScryptN = 1 << 20
+	maxScryptR = 32
+	maxScryptP = 16
+	maxScryptMemory = 1 << 30 // 128 * N * R bytes
+)
+
+// Check that deriving a key with p is possible and doesn't take too much
+func (p ScryptParams) validate() error {
+	if p.N < 2 || p.N > maxScryptN || p.N&(p.N-1) != 0 {
+		return fmt.Errorf("%w: n=%d", ErrBadScryptParams, p.N)
+	}
+	if p.R < 1 || p.R > maxScryptR || p.P < 1 || p.P > maxScryptP {
+		return fmt.Errorf("%w: r=%d p=%d", ErrBadScryptParams, p.R, p.P)
+	}
+	if 128*int64(p.N)*int64(p.R) > maxScryptMemory {
+		return fmt.Errorf("%w: n=%d r=%d", ErrBadScryptParams, p.N, p.R)
+	}
+
+	return nil
+}
+
+func (p ScryptParams) weakerThan(other ScryptParams) bool {
+	return p.N < other.N || p.R < other.R || p.P < other.P
+}
+
+// Key file as it's stored, version 1:
+//
+//   {
+//     "version": 1,
+//     "address": "dar1...",
+//     "type": 0,                 address.AccountType of the key
+//     "kdf": {"n": 32768, "r": 8, "p": 1, "salt": "<base64>"},
+//     "cipher": "aes-256-gcm",
+//     "nonce": "<base64>",
+//     "ciphertext": "<base64>"   entropy of the key pair, address as additional data
+//   }
+type keyFile struct {
+	Version		int					`json:"version"`
+	Address		string				`json:"address"`
+	Type		address.AccountType	`json:"type"`
+	KDF			ScryptParams		`json:"kdf"`
+	Cipher		string				`json:"cipher"`
+	Nonce		[]byte				`json:"nonce"`
+	Ciphertext	[]byte				`json:"ciphertext"`
+}
+
+// Upgrades of a file of version n to version n+1, keyed by n
+var upgrades = map[int]func(raw []byte) ([]byte, error){}
+
+// Parse a key file of any known version into the current one
+func decodeKeyFile(raw []byte) (keyFile, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return keyFile{}, ErrCorruptKey
+	}
+	if header.Version < 1 || header.Version > Version {
+		return keyFile{}, ErrUnsupportedVersion
+	}
+
+	for v := header.Version; v < Version; v++ {
+		upgrade, ok := upgrades[v]
+		if !ok {
+			return keyFile{}, ErrUnsupportedVersion
+		}
+
+		var err error
+		if raw, err = upgrade(raw); err != nil {
+			return keyFile{}, err
+		}
+	}
+
+	var f keyFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return keyFile{}, ErrCorruptKey
+	}
+	f.Version = header.Version // Still the version on disk, until it's migrated
+
+	return f, nil
+}
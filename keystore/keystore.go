@@ -0,0 +1,292 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/thomasbeukema/dargent/address"
+	"github.com/thomasbeukema/dargent/store"
+)
+
+var (
+	ErrKeyNotFound = errors.New("Key not found")
+	ErrKeyExists = errors.New("Key already in keystore")
+	ErrWrongPassphrase = errors.New("Wrong passphrase or corrupt key")
+	ErrUnsupportedVersion = errors.New("Unsupported keystore version")
+	ErrCorruptKey = errors.New("Key file is corrupt")
+	ErrBadScryptParams = errors.New("Scrypt parameters out of range")
+)
+
+// Key pairs the keystore can hold: everything which can be derived again
+// from its entropy through the algorithm registry
+type KeyPair interface {
+	address.Signer
+	GetEntropy() []byte
+}
+
+// Keeps key pairs encrypted with a passphrase, one file per address. The
+// entropy of a key pair is sealed with AES-256-GCM under a key derived from
+// the passphrase with scrypt; the address is authenticated along with it.
+type KeyStore struct {
+	store	store.Store
+	params	ScryptParams // Used for keys saved from now on
+}
+
+func New(s store.Store) *KeyStore {
+	return &KeyStore{store: s, params: DefaultScryptParams}
+}
+
+// Use other scrypt parameters for keys saved from now on, e.g. cheaper ones
+// on small devices
+func (ks *KeyStore) SetScryptParams(params ScryptParams) {
+	ks.params = params
+}
+
+func keyKey(addr string) string {
+	return store.Key("keystore", addr+".json")
+}
+
+// Name of the file holding the key of addr. Keys are saved under their
+// address when they were saved, which may be one of another network or a
+// legacy one, so any address of the same key finds it.
+func (ks *KeyStore) fileOf(addr string) (string, bool) {
+	if store.Exists(ks.store, keyKey(addr)) {
+		return addr, true
+	}
+
+	names, err := ks.List()
+	if err != nil {
+		return "", false
+	}
+	for _, name := range names {
+		if address.SameKey(name, addr) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// Encrypt kp with passphrase and save it
+func (ks *KeyStore) Save(kp KeyPair, passphrase string) error {
+	if _, ok := ks.fileOf(kp.GetAddress()); ok {
+		return ErrKeyExists
+	}
+
+	return ks.write(kp, passphrase)
+}
+
+// List the addresses of all keys in the keystore
+func (ks *KeyStore) List() ([]string, error) {
+	names, err := ks.store.List("keystore")
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(names))
+	for _, name := range names {
+		if strings.HasSuffix(name, ".json") {
+			addrs = append(addrs, strings.TrimSuffix(name, ".json"))
+		}
+	}
+
+	return addrs, nil
+}
+
+// Decrypt the key pair of addr
+func (ks *KeyStore) Load(addr string, passphrase string) (KeyPair, error) {
+	f, err := ks.read(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	entropy, err := f.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := address.LookupAlgorithm(f.Type)
+	if !ok || a.NewKeyPair == nil {
+		return nil, address.ErrUnknownAlgorithm
+	}
+
+	signer, err := a.NewKeyPair(entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	kp, ok := signer.(KeyPair)
+	if !ok {
+		return nil, address.ErrUnknownAlgorithm
+	}
+	if !address.SameKey(kp.GetAddress(), addr) { // Derivation changed or the file was tampered with
+		return nil, ErrCorruptKey
+	}
+
+	return kp, nil
+}
+
+// Encrypt the key of addr with a new passphrase; the file is saved again
+// under the address of the current network
+func (ks *KeyStore) ChangePassphrase(addr string, oldPassphrase string, newPassphrase string) error {
+	kp, err := ks.Load(addr, oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	name, _ := ks.fileOf(addr)
+	if err := ks.write(kp, newPassphrase); err != nil {
+		return err
+	}
+	if name == kp.GetAddress() {
+		return nil
+	}
+
+	return ks.store.Delete(keyKey(name))
+}
+
+// Remove the key of addr from the keystore
+func (ks *KeyStore) Delete(addr string) error {
+	name, ok := ks.fileOf(addr)
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	return ks.store.Delete(keyKey(name))
+}
+
+// Check whether the key of addr is stored in an older format or with weaker
+// scrypt parameters than the keystore uses now
+func (ks *KeyStore) NeedsMigration(addr string) (bool, error) {
+	f, err := ks.read(addr)
+	if err != nil {
+		return false, err
+	}
+
+	return f.Version < Version || f.KDF.weakerThan(ks.params), nil
+}
+
+// Rewrite the key of addr in the current format with the current parameters
+func (ks *KeyStore) Migrate(addr string, passphrase string) error {
+	migrate, err := ks.NeedsMigration(addr)
+	if err != nil || !migrate {
+		return err
+	}
+
+	return ks.ChangePassphrase(addr, passphrase, passphrase)
+}
+
+func (ks *KeyStore) read(addr string) (keyFile, error) {
+	name, ok := ks.fileOf(addr)
+	if !ok {
+		return keyFile{}, ErrKeyNotFound
+	}
+
+	raw, err := ks.store.Get(keyKey(name))
+	if err == store.ErrNotFound {
+		return keyFile{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return keyFile{}, err
+	}
+
+	f, err := decodeKeyFile(raw)
+	if err != nil {
+		return keyFile{}, err
+	}
+	if f.Address != name {
+		return keyFile{}, ErrCorruptKey
+	}
+
+	return f, nil
+}
+
+func (ks *KeyStore) write(kp KeyPair, passphrase string) error {
+	f, err := seal(kp, passphrase, ks.params)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ks.store.Put(keyKey(f.Address), raw)
+}
+
+// Encrypt the entropy of kp in a file of the current version
+func seal(kp KeyPair, passphrase string, params ScryptParams) (keyFile, error) {
+	f := keyFile{
+		Version: Version,
+		Address: kp.GetAddress(),
+		Type: kp.Algorithm(),
+		KDF: params,
+		Cipher: "aes-256-gcm",
+	}
+
+	f.KDF.Salt = make([]byte, saltSize)
+	if _, err := rand.Read(f.KDF.Salt); err != nil {
+		return keyFile{}, err
+	}
+
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return keyFile{}, err
+	}
+
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return keyFile{}, err
+	}
+
+	f.Ciphertext = aead.Seal(nil, f.Nonce, kp.GetEntropy(), []byte(f.Address))
+
+	return f, nil
+}
+
+// Decrypt the entropy in f
+func (f *keyFile) open(passphrase string) ([]byte, error) {
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, ErrCorruptKey
+	}
+
+	entropy, err := aead.Open(nil, f.Nonce, f.Ciphertext, []byte(f.Address))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return entropy, nil
+}
+
+// Cipher keyed by the passphrase
+func (f *keyFile) aead(passphrase string) (cipher.AEAD, error) {
+	if f.Cipher != "aes-256-gcm" {
+		return nil, ErrUnsupportedVersion
+	}
+	if err := f.KDF.validate(); err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), f.KDF.Salt, f.KDF.N, f.KDF.R, f.KDF.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
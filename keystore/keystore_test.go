@@ -0,0 +1,195 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/thomasbeukema/dargent/address"
+	"github.com/thomasbeukema/dargent/store"
+)
+
+// Cheap parameters, the defaults take a second per key
+var testParams = ScryptParams{N: 1 << 10, R: 8, P: 1}
+
+func TestLoadAfterNetworkChange(t *testing.T) {
+	defer address.SetNetwork(address.CurrentNetwork())
+
+	ks := New(store.NewMemoryStore())
+	ks.SetScryptParams(testParams)
+
+	kp, err := address.GenerateECCKeyPair(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Save(kp, "pass"); err != nil {
+		t.Fatal(err)
+	}
+	mainnet := kp.GetAddress()
+
+	address.SetNetwork(address.TESTNET)
+	testnet := kp.GetAddress()
+
+	for _, addr := range []string{mainnet, testnet} {
+		loaded, err := ks.Load(addr, "pass")
+		if err != nil {
+			t.Fatalf("loading %s: %v", addr, err)
+		}
+		if loaded.GetAddress() != testnet {
+			t.Fatalf("loaded %s", loaded.GetAddress())
+		}
+	}
+
+	if err := ks.Save(kp, "pass"); err != ErrKeyExists {
+		t.Fatalf("saved twice: %v", err)
+	}
+
+	if err := ks.ChangePassphrase(mainnet, "pass", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := ks.List(); len(names) != 1 || names[0] != testnet {
+		t.Fatalf("after rewriting: %v", names)
+	}
+	if err := ks.Delete(mainnet); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Save a fresh key and return the keystore with its address
+func savedKey(t *testing.T) (*KeyStore, string) {
+	t.Helper()
+
+	ks := New(store.NewMemoryStore())
+	ks.SetScryptParams(testParams)
+
+	kp, err := address.GenerateECCKeyPair(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Save(kp, "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	return ks, kp.GetAddress()
+}
+
+// Change the stored file of addr
+func tamper(t *testing.T, ks *KeyStore, addr string, change func(f *keyFile)) {
+	t.Helper()
+
+	raw, err := ks.store.Get(keyKey(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f keyFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		t.Fatal(err)
+	}
+	change(&f)
+	if raw, err = json.Marshal(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.store.Put(keyKey(addr), raw); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	ks, addr := savedKey(t)
+
+	if _, err := ks.Load(addr, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("got %v, want ErrWrongPassphrase", err)
+	}
+	if err := ks.ChangePassphrase(addr, "wrong", "new"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("changed with the wrong passphrase: %v", err)
+	}
+	if _, err := ks.Load(addr, "pass"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTamperedKeyFile(t *testing.T) {
+	tests := []struct {
+		name	string
+		change	func(f *keyFile)
+		want	error
+	}{
+		{"ciphertext", func(f *keyFile) { f.Ciphertext[0] ^= 1 }, ErrWrongPassphrase},
+		{"nonce", func(f *keyFile) { f.Nonce[0] ^= 1 }, ErrWrongPassphrase},
+		{"salt", func(f *keyFile) { f.KDF.Salt[0] ^= 1 }, ErrWrongPassphrase},
+		{"short nonce", func(f *keyFile) { f.Nonce = f.Nonce[1:] }, ErrCorruptKey},
+		{"address", func(f *keyFile) { f.Address = "dar1other" }, ErrCorruptKey},
+		{"cipher", func(f *keyFile) { f.Cipher = "rot13" }, ErrUnsupportedVersion},
+		{"version", func(f *keyFile) { f.Version = Version + 1 }, ErrUnsupportedVersion},
+		{"huge n", func(f *keyFile) { f.KDF.N = 1 << 30 }, ErrBadScryptParams},
+		{"n not a power of 2", func(f *keyFile) { f.KDF.N = 1000 }, ErrBadScryptParams},
+		{"huge r", func(f *keyFile) { f.KDF.R = 1 << 20 }, ErrBadScryptParams},
+		{"huge p", func(f *keyFile) { f.KDF.P = 1 << 20 }, ErrBadScryptParams},
+		{"huge memory", func(f *keyFile) { f.KDF.N, f.KDF.R = maxScryptN, maxScryptR }, ErrBadScryptParams},
+		{"no r", func(f *keyFile) { f.KDF.R = 0 }, ErrBadScryptParams},
+	}
+
+	for _, test := range tests {
+		ks, addr := savedKey(t)
+		tamper(t, ks, addr, test.change)
+
+		if _, err := ks.Load(addr, "pass"); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ks, addr := savedKey(t)
+
+	if migrate, err := ks.NeedsMigration(addr); err != nil || migrate {
+		t.Fatal("fresh key needs migration", err)
+	}
+	if err := ks.Migrate(addr, "wrong"); err != nil { // Nothing to do, so not even checked
+		t.Fatal(err)
+	}
+
+	stronger := testParams
+	stronger.N *= 2
+	ks.SetScryptParams(stronger)
+
+	if migrate, err := ks.NeedsMigration(addr); err != nil || !migrate {
+		t.Fatal("weaker key doesn't need migration", err)
+	}
+	if err := ks.Migrate(addr, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("migrated with the wrong passphrase: %v", err)
+	}
+	if err := ks.Migrate(addr, "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrate, err := ks.NeedsMigration(addr); err != nil || migrate {
+		t.Fatal("still needs migration after Migrate", err)
+	}
+	f, err := ks.read(addr)
+	if err != nil || f.KDF.N != stronger.N || f.Version != Version {
+		t.Fatalf("migrated to %+v, %v", f, err)
+	}
+	if _, err := ks.Load(addr, "pass"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.NeedsMigration("dar1missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal(err)
+	}
+}
+
+func TestSaveRejectsBadParams(t *testing.T) {
+	ks := New(store.NewMemoryStore())
+	ks.SetScryptParams(ScryptParams{N: maxScryptN * 2, R: 8, P: 1})
+
+	kp, err := address.GenerateECCKeyPair(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Save(kp, "pass"); !errors.Is(err, ErrBadScryptParams) {
+		t.Fatalf("got %v, want ErrBadScryptParams", err)
+	}
+	if names, _ := ks.List(); len(names) != 0 {
+		t.Fatal(names)
+	}
+}
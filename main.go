@@ -1,21 +1,53 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"runtime"
 
 	"github.com/thomasbeukema/dargent/account"
 	"github.com/thomasbeukema/dargent/address"
+	"github.com/thomasbeukema/dargent/store"
 
 	_ "github.com/davecgh/go-spew/spew"
 )
 
 func main() {
+	if err := run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if name := os.Getenv("DARGENT_NETWORK"); name != "" { // mainnet, testnet or regtest
+		n, err := address.ParseNetwork(name)
+		if err != nil {
+			return err
+		}
+		address.SetNetwork(n)
+	}
+	if genesis := os.Getenv("DARGENT_GENESIS"); genesis != "" { // Address whose CREATE issues all ART
+		if err := account.SetGenesisAccount(genesis); err != nil {
+			return err
+		}
+	}
 
 	m := "mundane atom sack seventh goldfish cottage vacation lemon pram eclipse syndrome return firm after arises bobsled tadpoles shipped tugs second sipped uphill afraid ardent"
-	e := address.MnemonicToEntropy(m)
+	e, err := address.MnemonicToEntropy(m)
+	if err != nil {
+		return err
+	}
 
-	kp1 := address.GenerateECCKeyPair(e[:])
-	kp2 := address.GenerateSPHINCSKeyPair(e[:])
+	kp1, err := address.GenerateECCKeyPair(e[:])
+	if err != nil {
+		return err
+	}
+	kp2, err := address.GenerateSPHINCSKeyPair(e[:])
+	if err != nil {
+		return err
+	}
 
 	pk2 := kp2.PublicKey[:]
 
@@ -27,21 +59,60 @@ func main() {
 	fmt.Printf("Address 2: %s\n", a2)
 	fmt.Printf("Mnemonic 2: %s\n", kp2.Mnemonic())
 
-	tx1, _ := account.NewCreateTransaction(kp1.PublicKey)
-	tx2, _ := account.NewCreateTransaction(pk2)
+	tx1, err := account.NewCreateTransaction(kp1.PublicKey, kp1)
+	if err != nil {
+		return err
+	}
+	tx2, err := account.NewCreateTransaction(pk2, kp2)
+	if err != nil {
+		return err
+	}
+	if err := tx1.GenerateWork(context.Background(), runtime.NumCPU()); err != nil {
+		return err
+	}
+	if err := tx2.GenerateWork(context.Background(), runtime.NumCPU()); err != nil {
+		return err
+	}
 
-	acc1 := account.OpenAccount(a1, kp1.PublicKey)
-	acc1.AddTransaction(tx1)
+	s := store.NewFileStore("data")
+	if _, err := account.Recover(s); err != nil {
+		return err
+	}
 
-	acc2 := account.OpenAccount(a2, pk2)
-	acc2.AddTransaction(tx2)
+	acc1, err := account.OpenAccount(s, a1, kp1.PublicKey)
+	if err != nil {
+		return err
+	}
+	fmt.Println(acc1.AddTransaction(tx1))
 
-	led1 := acc1.OpenLedger(account.NativeCurrency().Ticker)
-	led2 := acc2.OpenLedger(account.NativeCurrency().Ticker)
+	acc2, err := account.OpenAccount(s, a2, pk2)
+	if err != nil {
+		return err
+	}
+	fmt.Println(acc2.AddTransaction(tx2))
 
-	s1 := kp1.Sign([]byte(led1.Hash))
-	s2 := kp2.Sign([]byte(led2.Hash))
+	led1, err := acc1.OpenLedger(account.NativeCurrency().Ticker)
+	if err != nil {
+		return err
+	}
+	led2, err := acc2.OpenLedger(account.NativeCurrency().Ticker)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Balance 1: %s\n", account.NativeCurrency().Format(led1.Balance()))
+	fmt.Printf("Balance 2: %s\n", account.NativeCurrency().Format(led2.Balance()))
+
+	s1, err := kp1.Sign([]byte(led1.Hash))
+	if err != nil {
+		return err
+	}
+	s2, err := kp2.Sign([]byte(led2.Hash))
+	if err != nil {
+		return err
+	}
 
 	fmt.Println(led1.UpdateSignature(s1, &acc1))
 	fmt.Println(led2.UpdateSignature(s2, &acc2))
+
+	return nil
 }
@@ -1,10 +1,48 @@
 package node
 
+import (
+	"net"
+)
+
+// A client sends messages to one peer. It shares the UDP socket of the server,
+// so the peer sees the address we are listening on as the sender.
 type client struct {
-    dest    string
-    conn net.UDPConn
+	dest	string
+	addr	*net.UDPAddr
+	conn	*net.UDPConn
+}
+
+func newClient(dest string, conn *net.UDPConn) (*client, error) {
+	addr, err := net.ResolveUDPAddr("udp", dest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{addr.String(), addr, conn}, nil
 }
 
-func (c *client) Send(msg string) {
+// Send msg to the peer as a single datagram, or as fragments when it
+// doesn't fit in one
+func (c *client) Send(msg Message) error {
+	b, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+
+	if len(b) <= maxDatagramSize {
+		_, err = c.conn.WriteToUDP(b, c.addr)
+		return err
+	}
+
+	for _, f := range fragment(b) {
+		encoded, err := f.Encode()
+		if err != nil {
+			return err
+		}
+		if _, err := c.conn.WriteToUDP(encoded, c.addr); err != nil {
+			return err
+		}
+	}
 
+	return nil
 }
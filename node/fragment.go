@@ -0,0 +1,133 @@
+package node
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+const (
+	// id + index + count
+	fragmentHeaderSize = 8 + 2 + 2
+	// Bytes of the encoded message in one fragment
+	maxFragmentData = maxPayloadSize - fragmentHeaderSize
+	// Most fragments a message is split into
+	maxFragments = (maxMessageSize + headerSize + maxFragmentData - 1) / maxFragmentData
+
+	// Messages being put back together at once, the oldest is dropped
+	// when more come in
+	maxReassembling = 64
+	// How long the fragments of an incomplete message are kept
+	fragmentTimeout = 10 * time.Second
+)
+
+// Split an encoded message which doesn't fit in one datagram over FRAGMENT
+// messages. Every fragment carries an id shared by all fragments of the
+// message, its index and the number of fragments:
+//
+//   id (8 bytes) || index (uint16) || count (uint16) || part of the message
+func fragment(encoded []byte) []Message {
+	id := rand.Uint64()
+	count := (len(encoded) + maxFragmentData - 1) / maxFragmentData
+
+	msgs := make([]Message, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * maxFragmentData
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+
+		payload := make([]byte, fragmentHeaderSize, fragmentHeaderSize+end-i*maxFragmentData)
+		binary.BigEndian.PutUint64(payload[0:8], id)
+		binary.BigEndian.PutUint16(payload[8:10], uint16(i))
+		binary.BigEndian.PutUint16(payload[10:12], uint16(count))
+		payload = append(payload, encoded[i*maxFragmentData:end]...)
+
+		msgs = append(msgs, Message{FRAGMENT, payload})
+	}
+
+	return msgs
+}
+
+// Fragments received so far of one message
+type partialMessage struct {
+	parts		[][]byte
+	missing		int
+	started		time.Time
+}
+
+// Puts fragmented messages back together. Only used by the receive loop, so
+// it isn't safe for concurrent use.
+type reassembler struct {
+	messages	map[string]*partialMessage // By sender and id
+	order		[]string // Oldest first
+}
+
+func newReassembler() reassembler {
+	return reassembler{messages: make(map[string]*partialMessage)}
+}
+
+// Add a fragment from a peer; returns the encoded message once all its
+// fragments arrived. Malformed fragments are dropped.
+func (r *reassembler) add(from string, payload []byte) ([]byte, bool) {
+	if len(payload) <= fragmentHeaderSize {
+		return nil, false
+	}
+
+	id := binary.BigEndian.Uint64(payload[0:8])
+	index := int(binary.BigEndian.Uint16(payload[8:10]))
+	count := int(binary.BigEndian.Uint16(payload[10:12]))
+	if count < 2 || count > maxFragments || index >= count {
+		return nil, false
+	}
+
+	r.expire()
+
+	key := from + "/" + strconv.FormatUint(id, 16)
+	m, ok := r.messages[key]
+	if !ok {
+		if len(r.order) >= maxReassembling {
+			r.drop(r.order[0])
+		}
+		m = &partialMessage{parts: make([][]byte, count), missing: count, started: time.Now()}
+		r.messages[key] = m
+		r.order = append(r.order, key)
+	}
+	if len(m.parts) != count || m.parts[index] != nil {
+		return nil, false
+	}
+
+	m.parts[index] = append([]byte{}, payload[fragmentHeaderSize:]...)
+	m.missing--
+	if m.missing > 0 {
+		return nil, false
+	}
+
+	r.drop(key)
+
+	var encoded []byte
+	for _, part := range m.parts {
+		encoded = append(encoded, part...)
+	}
+
+	return encoded, true
+}
+
+// Drop messages which didn't complete in time
+func (r *reassembler) expire() {
+	for len(r.order) > 0 && time.Since(r.messages[r.order[0]].started) > fragmentTimeout {
+		r.drop(r.order[0])
+	}
+}
+
+func (r *reassembler) drop(key string) {
+	delete(r.messages, key)
+
+	for i, k := range r.order {
+		if k == key {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			return
+		}
+	}
+}
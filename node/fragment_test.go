@@ -0,0 +1,122 @@
+package node
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/thomasbeukema/dargent/account"
+	"github.com/thomasbeukema/dargent/address"
+)
+
+func TestFragmentReassemble(t *testing.T) {
+	payload := bytes.Repeat([]byte("dargent"), 3*maxPayloadSize/7)
+	msg := Message{LEDGER_REPLY, payload}
+	encoded, err := msg.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frags := fragment(encoded)
+	if len(frags) != 4 {
+		t.Fatalf("%d fragments", len(frags))
+	}
+
+	r := newReassembler()
+	order := []int{2, 0, 0, 3, 1} // Out of order, with a duplicate
+	for i, j := range order {
+		if b, _ := frags[j].Encode(); len(b) > maxDatagramSize {
+			t.Fatalf("fragment of %d bytes", len(b))
+		}
+
+		got, complete := r.add("peer", frags[j].Payload)
+		if complete != (i == len(order)-1) {
+			t.Fatalf("complete after %d fragments: %v", i+1, complete)
+		}
+		if complete && !bytes.Equal(got, encoded) {
+			t.Fatal("reassembled message differs")
+		}
+	}
+
+	if len(r.messages) != 0 || len(r.order) != 0 {
+		t.Fatal("completed message kept")
+	}
+}
+
+func TestReassemblerBounded(t *testing.T) {
+	r := newReassembler()
+
+	for i := 0; i < maxReassembling+10; i++ {
+		frags := fragment(make([]byte, maxFragmentData+1))
+		r.add("peer", frags[0].Payload)
+	}
+	if len(r.messages) != maxReassembling {
+		t.Fatalf("%d messages kept", len(r.messages))
+	}
+
+	for _, payload := range [][]byte{
+		nil,
+		make([]byte, fragmentHeaderSize),
+		{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 'x'}, // Single fragment
+		{0, 0, 0, 0, 0, 0, 0, 1, 0, 5, 0, 2, 'x'}, // Index past count
+		{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0xff, 0xff, 'x'}, // Too many fragments
+	} {
+		if _, complete := r.add("other", payload); complete {
+			t.Fatalf("%x completed a message", payload)
+		}
+	}
+	if len(r.messages) != maxReassembling {
+		t.Fatal("malformed fragment kept")
+	}
+}
+
+// A multisig account with SPHINCS cosigners signs txs far larger than a
+// datagram; they have to get through anyway
+func TestPublishLargeTransaction(t *testing.T) {
+	nodes := newTestNodes(t, 2)
+
+	ecc := testKey(t, 3)
+	var sphincs [2]address.SPHINCSKeyPair
+	for i := range sphincs {
+		entropy := make([]byte, 32)
+		entropy[0] = byte(i)
+		var err error
+		if sphincs[i], err = address.GenerateSPHINCSKeyPair(entropy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, err := address.NewMultisigKey(2, ecc, sphincs[0], sphincs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := account.Transaction{
+		Action: account.CREATE,
+		Currency: account.NativeCurrency(),
+		Origin: base64.StdEncoding.EncodeToString(key.GetPublicKey()),
+	}
+	var partials []address.PartialSignature
+	for _, signer := range []address.Signer{sphincs[0], sphincs[1]} {
+		p, err := create.SignPartial(key, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials = append(partials, p)
+	}
+	if err := create.Sign(address.Cosigned{MultisigKey: key, Partials: partials}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := NewMessage(PUBLISH, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Payload) <= maxPayloadSize {
+		t.Fatalf("tx of %d bytes fits in a datagram", len(msg.Payload))
+	}
+
+	if err := nodes[0].PublishTransaction(create); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "large tx", func() bool { return ledgerLength(nodes[1], key.GetAddress()) == 1 })
+}
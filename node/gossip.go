@@ -0,0 +1,261 @@
+package node
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/thomasbeukema/dargent/account"
+	"github.com/thomasbeukema/dargent/address"
+)
+
+const (
+	// Number of tx hashes remembered for duplicate suppression
+	maxSeenTransactions = 100000
+
+	// Number of txs kept while waiting for the tx they depend on
+	maxOrphans = 1000
+)
+
+// Remembers which transactions passed through the node, so a tx floods the
+// network only once instead of echoing between peers forever
+type seenSet struct {
+	hashes	map[string]struct{}
+	order	[]string // Oldest first, used to forget old hashes
+}
+
+func newSeenSet() seenSet {
+	return seenSet{
+		hashes: make(map[string]struct{}),
+		order: make([]string, 0),
+	}
+}
+
+// Check whether hash was seen before
+func (s *seenSet) has(hash string) bool {
+	_, ok := s.hashes[hash]
+	return ok
+}
+
+// Mark hash as seen, returns false if it was seen before
+func (s *seenSet) add(hash string) bool {
+	if _, ok := s.hashes[hash]; ok {
+		return false
+	}
+
+	if len(s.order) >= maxSeenTransactions {
+		delete(s.hashes, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	s.hashes[hash] = struct{}{}
+	s.order = append(s.order, hash)
+
+	return true
+}
+
+// Tx which arrived before the tx it depends on: the one it follows, or the
+// SEND it claims
+type orphan struct {
+	parent	string
+	tx		account.Transaction
+	from	string
+}
+
+// Orphans waiting for their parent, oldest first; the oldest are dropped
+// when there are too many
+type orphanPool struct {
+	list	[]orphan
+}
+
+func (p *orphanPool) add(o orphan) {
+	for _, waiting := range p.list {
+		if waiting.tx.Hash == o.tx.Hash {
+			return
+		}
+	}
+
+	if len(p.list) >= maxOrphans {
+		p.list = p.list[1:]
+	}
+	p.list = append(p.list, o)
+}
+
+// Remove and return the orphans waiting for parent
+func (p *orphanPool) take(parent string) []orphan {
+	var found []orphan
+	kept := p.list[:0]
+
+	for _, o := range p.list {
+		if o.parent == parent {
+			found = append(found, o)
+		} else {
+			kept = append(kept, o)
+		}
+	}
+	p.list = kept
+
+	return found
+}
+
+// Hash of the tx which tx waits for when it got rejected with err, empty
+// when it doesn't depend on a missing tx
+func missingParent(tx account.Transaction, err error) string {
+	switch {
+		case errors.Is(err, account.ErrBrokenChain), errors.Is(err, account.ErrAccountNotFound):
+			return tx.PreviousHash
+		case errors.Is(err, account.ErrInvalidClaim) && tx.Action == account.CLAIM:
+			return tx.Origin
+	}
+
+	return ""
+}
+
+// Apply tx to the local ledger and forward it to all peers when accepted. A
+// tx following or claiming one the node doesn't have yet is kept, and
+// published once that one is accepted.
+func (n *Node) PublishTransaction(tx account.Transaction) error {
+	return n.accept(tx, "")
+}
+
+// Validate a tx received from a peer, apply it and pass it on
+func (n *Node) handlePublish(from string, msg Message) {
+	var tx account.Transaction
+	if err := msg.Decode(&tx); err != nil {
+		return
+	}
+
+	n.accept(tx, from)
+}
+
+// Apply tx and pass it on to every peer but from. Only accepted txs count
+// as seen, so a tx which failed can be tried again.
+func (n *Node) accept(tx account.Transaction, from string) error {
+	if n.isSeen(tx.Hash) {
+		return nil // Already published
+	}
+
+	err := n.applyTransaction(tx)
+	if errors.Is(err, account.ErrDuplicateTransaction) {
+		n.markSeen(tx.Hash)
+		return nil
+	}
+	if errors.Is(err, account.ErrFork) { // Every node needs all candidates to pick the same winner
+		if !n.markSeen(tx.Hash) {
+			return err
+		}
+		if !n.inLedger(tx) { // Lost, only pass it on
+			n.forward(tx, from)
+			return err
+		}
+		n.adopt(tx, from) // Won, our chain switched to it
+		return err
+	}
+	if err != nil {
+		if parent := missingParent(tx, err); parent != "" {
+			n.mu.Lock()
+			n.orphans.add(orphan{parent, tx, from})
+			n.mu.Unlock()
+		}
+		return err
+	}
+
+	if !n.markSeen(tx.Hash) { // Accepted by another goroutine at the same time
+		return nil
+	}
+
+	return n.adopt(tx, from)
+}
+
+// Pass on tx which is in our chain now, vote on it and retry the txs which
+// waited for it
+func (n *Node) adopt(tx account.Transaction, from string) error {
+	err := n.forward(tx, from)
+	if voteErr := n.vote(tx); err == nil {
+		err = voteErr
+	}
+
+	n.mu.Lock()
+	waiting := n.orphans.take(tx.Hash)
+	n.mu.Unlock()
+	for _, o := range waiting {
+		n.accept(o.tx, o.from)
+	}
+
+	return err
+}
+
+// Check whether tx is in the chain of its ledger
+func (n *Node) inLedger(tx account.Transaction) bool {
+	acc, err := account.OpenAccount(n.store, tx.AccountAddress(), nil)
+	if err != nil || !acc.HasLedger(tx.Currency.Ticker) {
+		return false
+	}
+
+	led, err := acc.OpenLedger(tx.Currency.Ticker)
+	return err == nil && led.Contains(tx.Hash)
+}
+
+func (n *Node) isSeen(hash string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.seen.has(hash)
+}
+
+func (n *Node) markSeen(hash string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.seen.add(hash)
+}
+
+// Add tx to the local copy of the ledger of its account
+func (n *Node) applyTransaction(tx account.Transaction) error {
+	addr := tx.AccountAddress()
+	if addr == "" {
+		return account.ErrInvalidTransaction
+	}
+
+	var pubkey []byte // Without a key, txs for accounts we don't know are rejected
+	if tx.Action == account.CREATE { // Opens a ledger, maybe of an account we don't know yet
+		var err error
+		pubkey, err = base64.StdEncoding.DecodeString(tx.Origin)
+		if err != nil {
+			return account.ErrBadEncoding
+		}
+		v, err := address.NewVerifier(address.TypeOfAddress(addr), pubkey)
+		if err != nil || !tx.Verify(v) { // Don't open an account for a tx we won't accept
+			return account.ErrInvalidTransaction
+		}
+	}
+
+	n.writes.Lock() // Ledgers are read, changed and written as a whole
+	defer n.writes.Unlock()
+
+	acc, err := account.OpenAccount(n.store, addr, pubkey)
+	if err != nil {
+		return err
+	}
+
+	return acc.AddTransaction(tx)
+}
+
+// Send tx to every peer except the one we got it from
+func (n *Node) forward(tx account.Transaction, from string) error {
+	msg, err := NewMessage(PUBLISH, tx)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, p := range n.Peers() {
+		if p == from {
+			continue
+		}
+		if err := n.Send(p, msg); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
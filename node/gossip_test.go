@@ -0,0 +1,242 @@
+package node
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thomasbeukema/dargent/account"
+	"github.com/thomasbeukema/dargent/address"
+	"github.com/thomasbeukema/dargent/store"
+)
+
+func TestMain(m *testing.M) {
+	account.SetWorkDifficulty(0)
+	os.Exit(m.Run())
+}
+
+// Nodes on loopback, each with its own store and connected to the one before
+// it, so txs have to hop to reach the end of the line
+func newTestNodes(t *testing.T, count int) []*Node {
+	t.Helper()
+
+	nodes := make([]*Node, count)
+	for i := range nodes {
+		n, err := NewNode("127.0.0.1:0", store.NewMemoryStore())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { n.Close() })
+		nodes[i] = n
+
+		if i > 0 {
+			if err := n.Connect(nodes[i-1].Addr()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i := 1; i < count; i++ {
+		waitFor(t, "handshake", func() bool { return len(nodes[i-1].Peers()) > 0 })
+	}
+
+	return nodes
+}
+
+// Wait up to a few seconds for cond to hold
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Deterministic key pair; the first one is used as genesis account
+func testKey(t testing.TB, i byte) address.ECCKeyPair {
+	entropy := make([]byte, 32)
+	entropy[0] = i
+
+	kp, err := address.GenerateECCKeyPair(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return kp
+}
+
+// Number of txs in the native ledger of addr on n
+func ledgerLength(n *Node, addr string) int {
+	acc, err := account.OpenAccount(n.store, addr, nil)
+	if err != nil || !acc.HasLedger(account.NativeCurrency().Ticker) {
+		return 0
+	}
+
+	led, err := acc.OpenLedger(account.NativeCurrency().Ticker)
+	if err != nil {
+		return 0
+	}
+
+	return len(led.TxList)
+}
+
+// Genesis CREATE, a SEND from it to another account and its CLAIM
+func testChain(t testing.TB) (genesis, send account.Transaction, create, claim account.Transaction) {
+	g, holder := testKey(t, 1), testKey(t, 2)
+	if err := account.SetGenesisAccount(g.GetAddress()); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, _ = account.NewGenesisTransaction(g.PublicKey, g)
+	send, _ = account.NewSendTransaction(g.GetAddress(), genesis.Hash, holder.GetAddress(), account.NativeSupply-25, account.NativeCurrency(), holder)
+	send.Sign(g)
+	create, _ = account.NewCreateTransaction(holder.PublicKey, holder)
+	claim, _ = account.NewClaimTransaction(holder.GetAddress(), create.Hash, send.Hash, 25, account.NativeCurrency(), holder)
+
+	return genesis, send, create, claim
+}
+
+func TestGossipConverges(t *testing.T) {
+	nodes := newTestNodes(t, 4)
+	genesis, send, create, claim := testChain(t)
+
+	// Published on different nodes, some before the tx they depend on
+	for i, tx := range []account.Transaction{claim, send, create, genesis} {
+		nodes[i%len(nodes)].PublishTransaction(tx)
+	}
+
+	for i, n := range nodes {
+		waitFor(t, "convergence", func() bool {
+			return ledgerLength(n, genesis.AccountAddress()) == 2 && ledgerLength(n, claim.AccountAddress()) == 2
+		})
+
+		var pending []account.Pending
+		var err error
+		waitFor(t, "claimed SEND to leave pending", func() bool { // Written right after the ledger
+			pending, err = account.PendingFor(n.store, claim.AccountAddress(), account.NativeCurrency().Ticker)
+			return err != nil || len(pending) == 0
+		})
+		if err != nil {
+			t.Errorf("node %d: pending %v, %v", i, pending, err)
+		}
+	}
+}
+
+func TestPublishRetriesAfterParent(t *testing.T) {
+	nodes := newTestNodes(t, 2)
+	a, b := nodes[0], nodes[1]
+	genesis, send, _, _ := testChain(t)
+
+	if err := b.PublishTransaction(send); err == nil {
+		t.Fatal("SEND before its CREATE accepted")
+	}
+	if err := a.PublishTransaction(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range nodes {
+		waitFor(t, "SEND after CREATE", func() bool { return ledgerLength(n, genesis.AccountAddress()) == 2 })
+	}
+
+	if err := b.PublishTransaction(send); err != nil { // Accepted now, nothing to do
+		t.Fatal(err)
+	}
+}
+
+// Txs applied at the same time, from the caller and from peers, all end up
+// in the ledger
+func TestConcurrentPublishKeepsBoth(t *testing.T) {
+	genesis, send, _, _ := testChain(t)
+	g, other := testKey(t, 1), testKey(t, 3)
+	rival, _ := account.NewSendTransaction(g.GetAddress(), genesis.Hash, other.GetAddress(), account.NativeSupply-50, account.NativeCurrency(), g)
+
+	for i := 0; i < 20; i++ {
+		n := newTestNodes(t, 1)[0]
+		if err := n.PublishTransaction(genesis); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for _, tx := range []account.Transaction{send, rival} {
+			wg.Add(1)
+			go func(tx account.Transaction) {
+				defer wg.Done()
+				n.PublishTransaction(tx)
+			}(tx)
+		}
+		wg.Wait()
+
+		acc, _ := account.OpenAccount(n.store, genesis.AccountAddress(), nil)
+		led, _ := acc.OpenLedger(account.NativeCurrency().Ticker)
+		if f, ok := led.ForkState(genesis.Hash); !ok || len(f.Candidates) != 2 {
+			t.Fatalf("run %d: fork %+v lost a candidate", i, f)
+		}
+	}
+}
+
+// Hash of the last tx in the native ledger of addr on n
+func lastHash(n *Node, addr string) string {
+	acc, err := account.OpenAccount(n.store, addr, nil)
+	if err != nil || !acc.HasLedger(account.NativeCurrency().Ticker) {
+		return ""
+	}
+
+	led, err := acc.OpenLedger(account.NativeCurrency().Ticker)
+	if err != nil || len(led.TxList) == 0 {
+		return ""
+	}
+
+	return led.TxList[len(led.TxList)-1].Hash
+}
+
+// Conflicting SENDs published at both ends of the line spread through the
+// network, and every node settles on the same one
+func TestGossipForkConverges(t *testing.T) {
+	nodes := newTestNodes(t, 3)
+	genesis, send, _, _ := testChain(t)
+	g, other := testKey(t, 1), testKey(t, 3)
+
+	if err := nodes[0].PublishTransaction(genesis); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range nodes {
+		waitFor(t, "genesis", func() bool { return ledgerLength(n, genesis.AccountAddress()) == 1 })
+	}
+
+	rival, err := account.NewSendTransaction(g.GetAddress(), genesis.Hash, other.GetAddress(), account.NativeSupply-50, account.NativeCurrency(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes[0].PublishTransaction(send)
+	nodes[2].PublishTransaction(rival)
+
+	winner := send.Hash // Both SENDs, so the action in front doesn't matter
+	if rival.Hash < winner {
+		winner = rival.Hash
+	}
+	for i, n := range nodes {
+		waitFor(t, "fork to resolve on node "+strconv.Itoa(i), func() bool {
+			return lastHash(n, genesis.AccountAddress()) == winner
+		})
+	}
+}
+
+func TestSeenSetForgetsOldest(t *testing.T) {
+	s := newSeenSet()
+	for i := 0; i < maxSeenTransactions+1; i++ {
+		s.add(strconv.Itoa(i))
+	}
+
+	if s.has(strconv.Itoa(0)) || !s.has(strconv.Itoa(maxSeenTransactions)) {
+		t.Fatal("oldest hash not forgotten")
+	}
+	if s.add(strconv.Itoa(1)) {
+		t.Fatal("seen hash added again")
+	}
+}
@@ -0,0 +1,243 @@
+package node
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/thomasbeukema/dargent/account"
+)
+
+const (
+	// Every datagram starts with these bytes, anything else is dropped
+	protocolMagic uint32 = 0xDA46E117
+	// Version of the wire protocol spoken by this node; 2 sends transactions
+	// in their binary encoding and splits big messages into fragments
+	ProtocolVersion uint8 = 2
+
+	checksumSize = 4
+	// magic + version + type + length + checksum
+	headerSize = 4 + 1 + 1 + 4 + checksumSize
+	// Largest payload which still fits in a single datagram
+	maxPayloadSize = maxDatagramSize - headerSize
+	// Largest payload of a message sent as fragments
+	maxMessageSize = 1 << 20
+)
+
+// Define possible message types
+type MessageType uint8
+const (
+	HANDSHAKE MessageType = iota // 0
+	PUBLISH // 1: Publish a transaction
+	LEDGER_REQUEST // 2
+	LEDGER_REPLY // 3
+	PEER_LIST // 4
+	ACCOUNTS_REQUEST // 5
+	ACCOUNTS_REPLY // 6
+	VOTE // 7
+	FRAGMENT // 8: Part of a message too large for a single datagram
+)
+
+// Types from here on aren't part of the protocol; they're free for
+// applications and end up at the Handler of the node
+const FIRST_EXTENSION MessageType = 0x80
+
+var (
+	ErrShortMessage = errors.New("Message shorter than header")
+	ErrBadMagic = errors.New("Invalid magic number")
+	ErrBadVersion = errors.New("Unsupported protocol version")
+	ErrBadType = errors.New("Unknown message type")
+	ErrBadLength = errors.New("Payload length mismatch")
+	ErrBadChecksum = errors.New("Payload checksum mismatch")
+	ErrTooLarge = errors.New("Message too large")
+)
+
+// Envelope around everything sent between nodes
+type Message struct {
+	Type	MessageType
+	Payload	[]byte
+}
+
+// Payload of a HANDSHAKE message
+type Handshake struct {
+	Addr	string	`json:"a"` // Address the sender listens on
+	Nonce	uint64	`json:"n,omitempty"` // To be sent back by the receiver
+	Reply	uint64	`json:"r,omitempty"` // Nonce of the HANDSHAKE this answers
+}
+
+// Payload of a LEDGER_REQUEST message
+type LedgerRequest struct {
+	Address		string	`json:"a"`
+	Currency	string	`json:"c"`
+	From		string	`json:"f,omitempty"` // Last known Ledger.Hash, empty for the whole ledger
+}
+
+// Payload of a LEDGER_REPLY message, holds the transactions following From.
+// Big ledgers are split over multiple replies.
+type LedgerReply struct {
+	Address		string					`json:"a"`
+	Currency	string					`json:"c"`
+	From		string					`json:"f,omitempty"`
+	TxList		wireTransactions		`json:"t"`
+	Hash		string					`json:"h"` // Hash of the complete ledger
+	Signature	string					`json:"s,omitempty"` // Only in the last reply
+	More		bool					`json:"m,omitempty"` // More transactions follow
+}
+
+// Payload of an ACCOUNTS_REQUEST message
+type AccountsRequest struct {
+	Offset	int	`json:"o,omitempty"`
+}
+
+// Payload of an ACCOUNTS_REPLY message
+type AccountsReply struct {
+	Accounts	[]AccountSummary	`json:"a"`
+	Next		int					`json:"n,omitempty"` // Offset of the next page, 0 when done
+}
+
+// Account with the currencies it has a ledger for
+type AccountSummary struct {
+	Address		string		`json:"a"`
+	Currencies	[]string	`json:"c"`
+}
+
+// Payload of a PEER_LIST message
+type PeerList struct {
+	Peers	[]string	`json:"p"`
+}
+
+// Transactions inside a JSON payload, each in its binary encoding
+type wireTransactions []account.Transaction
+
+func (w wireTransactions) MarshalJSON() ([]byte, error) {
+	encoded := make([][]byte, len(w))
+	for i, tx := range w {
+		b, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = b
+	}
+
+	return json.Marshal(encoded)
+}
+
+func (w *wireTransactions) UnmarshalJSON(data []byte) error {
+	var encoded [][]byte
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	txs := make(wireTransactions, len(encoded))
+	for i, b := range encoded {
+		if err := txs[i].UnmarshalBinary(b); err != nil {
+			return err
+		}
+	}
+
+	*w = txs
+	return nil
+}
+
+// Create message of type t with v encoded as payload; in its binary encoding
+// when it has one, like a transaction, as JSON otherwise
+func NewMessage(t MessageType, v interface{}) (Message, error) {
+	if !t.valid() {
+		return Message{}, ErrBadType
+	}
+
+	var payload []byte
+	var err error
+	if m, ok := v.(encoding.BinaryMarshaler); ok {
+		payload, err = m.MarshalBinary()
+	} else {
+		payload, err = json.Marshal(v)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	if len(payload) > maxMessageSize {
+		return Message{}, ErrTooLarge
+	}
+
+	return Message{t, payload}, nil
+}
+
+// Decode the payload of the message into v
+func (m *Message) Decode(v interface{}) error {
+	if u, ok := v.(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary(m.Payload)
+	}
+
+	return json.Unmarshal(m.Payload, v)
+}
+
+// Encode message; when the result is larger than a datagram it has to be
+// sent as fragments
+func (m *Message) Encode() ([]byte, error) {
+	if !m.Type.valid() {
+		return nil, ErrBadType
+	}
+	if len(m.Payload) > maxMessageSize {
+		return nil, ErrTooLarge
+	}
+
+	b := make([]byte, headerSize+len(m.Payload))
+	binary.BigEndian.PutUint32(b[0:4], protocolMagic)
+	b[4] = ProtocolVersion
+	b[5] = byte(m.Type)
+	binary.BigEndian.PutUint32(b[6:10], uint32(len(m.Payload)))
+	copy(b[10:headerSize], payloadChecksum(m.Payload))
+	copy(b[headerSize:], m.Payload)
+
+	return b, nil
+}
+
+// Decode a received datagram or reassembled message; never trusts any field
+// of the input
+func DecodeMessage(b []byte) (Message, error) {
+	if len(b) < headerSize {
+		return Message{}, ErrShortMessage
+	}
+	if binary.BigEndian.Uint32(b[0:4]) != protocolMagic {
+		return Message{}, ErrBadMagic
+	}
+	if b[4] != ProtocolVersion {
+		return Message{}, ErrBadVersion
+	}
+
+	t := MessageType(b[5])
+	if !t.valid() {
+		return Message{}, ErrBadType
+	}
+
+	length := binary.BigEndian.Uint32(b[6:10])
+	if uint64(length) != uint64(len(b)-headerSize) {
+		return Message{}, ErrBadLength
+	}
+
+	payload := make([]byte, length)
+	copy(payload, b[headerSize:])
+
+	if !bytes.Equal(b[10:headerSize], payloadChecksum(payload)) {
+		return Message{}, ErrBadChecksum
+	}
+
+	return Message{t, payload}, nil
+}
+
+func (t MessageType) valid() bool {
+	return t <= FRAGMENT || t >= FIRST_EXTENSION
+}
+
+// First bytes of the double SHA-256 of the payload
+func payloadChecksum(payload []byte) []byte {
+	hash := sha256.Sum256(payload)
+	finalHash := sha256.Sum256(hash[:])
+
+	return finalHash[:checksumSize]
+}
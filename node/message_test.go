@@ -0,0 +1,79 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/thomasbeukema/dargent/account"
+)
+
+func FuzzDecodeMessage(f *testing.F) {
+	genesis, send, _, _ := testChain(f)
+	for _, v := range []struct {
+		t MessageType
+		v interface{}
+	}{
+		{HANDSHAKE, Handshake{Addr: "127.0.0.1:4000", Nonce: 1}},
+		{PUBLISH, send},
+		{LEDGER_REPLY, LedgerReply{Address: send.Origin, Currency: "ART", TxList: wireTransactions{genesis, send}}},
+		{PEER_LIST, PeerList{[]string{"127.0.0.1:4001"}}},
+		{FIRST_EXTENSION, "ping"},
+	} {
+		msg, err := NewMessage(v.t, v.v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		encoded, err := msg.Encode()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(encoded)
+		f.Add(encoded[:len(encoded)-1])
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		msg, err := DecodeMessage(b)
+		if err != nil {
+			return
+		}
+
+		encoded, err := msg.Encode()
+		if err != nil || !bytes.Equal(encoded, b) {
+			t.Fatalf("decoded message encodes to %x, %v", encoded, err)
+		}
+
+		// Payloads are just as untrusted as the envelope
+		var tx account.Transaction
+		msg.Decode(&tx)
+		var reply LedgerReply
+		msg.Decode(&reply)
+		var list PeerList
+		msg.Decode(&list)
+		var accounts AccountsReply
+		msg.Decode(&accounts)
+	})
+}
+
+// Two fragments of the same sender; complete messages consist of both their data
+func FuzzReassembler(f *testing.F) {
+	frags := fragment(bytes.Repeat([]byte{1}, maxFragmentData+1))
+	f.Add(frags[0].Payload, frags[1].Payload)
+	f.Add(frags[1].Payload, frags[1].Payload)
+	f.Add([]byte{}, frags[0].Payload[:fragmentHeaderSize])
+
+	f.Fuzz(func(t *testing.T, first, second []byte) {
+		r := newReassembler()
+		if _, complete := r.add("peer", first); complete {
+			t.Fatal("completed after one fragment")
+		}
+
+		b, complete := r.add("peer", second)
+		if complete && len(b) != len(first)+len(second)-2*fragmentHeaderSize {
+			t.Fatalf("reassembled %d bytes", len(b))
+		}
+		if len(r.messages) != len(r.order) || len(r.messages) > maxReassembling {
+			t.Fatalf("%d messages, %d in order", len(r.messages), len(r.order))
+		}
+	})
+}
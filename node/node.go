@@ -1,10 +1,414 @@
 package node
 
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/thomasbeukema/dargent/account"
+	"github.com/thomasbeukema/dargent/address"
+	"github.com/thomasbeukema/dargent/store"
+)
+
+const (
+	// Most peers a node keeps
+	maxPeers = 64
+	// How long an answer to a HANDSHAKE we sent is waited for
+	handshakeTimeout = 10 * time.Second
+)
+
+var ErrTooManyPeers = errors.New("Peer table is full")
+
+// Gets called for every message of an extension type the node receives from
+// a peer; the other types are part of the protocol and handled by the node
+type Handler func(from string, msg Message)
+
+// HANDSHAKE sent to an address which isn't a peer yet. It becomes one by
+// answering with the nonce, which whoever merely spoofs the address never sees.
+type handshake struct {
+	nonce	uint64
+	sent	time.Time
+}
+
 type Node struct {
-	s	server
-	c	client
+	s		*server
+	store	store.Store // Accounts and ledgers of this node
+	peers	map[string]*client // Known peers by address
+	dialing	map[string]handshake // Addresses we sent a HANDSHAKE which wasn't answered yet
+	handler	Handler
+	seen	seenSet // Transactions and votes which passed through this node
+	orphans	orphanPool // Transactions waiting for the one they depend on
+	frags	reassembler // Fragments of messages received so far
+	tally	*account.Tally
+	writes	sync.Mutex // Held while changing ledgers or pending lists in store
+	rep		address.Signer // Set when this node votes
+	mu		sync.RWMutex
+	done	chan struct{}
+}
+
+// Create a new node listening on host, keeping its data in s, and start
+// handling incoming messages
+func NewNode(host string, s store.Store) (*Node, error) {
+	if _, err := account.Recover(s); err != nil { // Finish writes interrupted by a crash
+		return nil, err
+	}
+
+	srv, err := newServer(host)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		s: srv,
+		store: s,
+		peers: make(map[string]*client),
+		dialing: make(map[string]handshake),
+		seen: newSeenSet(),
+		frags: newReassembler(),
+		tally: account.NewTally(s),
+		done: make(chan struct{}),
+	}
+
+	go n.listen()
+
+	return n, nil
+}
+
+// Address the node is listening on
+func (n *Node) Addr() string {
+	return n.s.addr.String()
+}
+
+// Set the function which handles incoming messages of extension types
+func (n *Node) Handle(h Handler) {
+	n.mu.Lock()
+	n.handler = h
+	n.mu.Unlock()
+}
+
+// Add peer to the table of known peers; adding a known peer is a no-op,
+// ErrTooManyPeers is returned when the table is full
+func (n *Node) AddPeer(addr string) error {
+	c, err := newClient(addr, n.s.conn)
+	if err != nil {
+		return err
+	}
+
+	if c.dest == n.Addr() { // Don't add ourselves
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.peers[c.dest]; ok {
+		return nil
+	}
+	if len(n.peers) >= maxPeers {
+		return ErrTooManyPeers
+	}
+	n.peers[c.dest] = c
+	delete(n.dialing, c.dest)
+
+	return nil
+}
+
+// Check whether addr is in the table of known peers
+func (n *Node) isPeer(addr string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	_, ok := n.peers[addr]
+	return ok
+}
+
+func (n *Node) RemovePeer(addr string) {
+	n.mu.Lock()
+	delete(n.peers, addr)
+	n.mu.Unlock()
+}
+
+// List addresses of all known peers
+func (n *Node) Peers() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	peers := make([]string, 0, len(n.peers))
+	for addr := range n.peers {
+		peers = append(peers, addr)
+	}
+
+	return peers
+}
+
+// Add peer and introduce ourselves, the peer answers with the peers it knows
+func (n *Node) Connect(addr string) error {
+	if err := n.AddPeer(addr); err != nil {
+		return err
+	}
+
+	c, err := newClient(addr, n.s.conn)
+	if err != nil {
+		return err
+	}
+
+	msg, err := NewMessage(HANDSHAKE, Handshake{Addr: n.Addr()})
+	if err != nil {
+		return err
+	}
+
+	return n.Send(c.dest, msg)
 }
 
-func NewNode(host string) {
+// Introduce ourselves to addr without adding it; it becomes a peer once it
+// answers with our nonce. reply is the nonce of a HANDSHAKE addr sent us, if
+// any, which we answer even when ours is still on its way. Nothing is sent when
+// the table is full; when too many HANDSHAKEs wait for an answer, the oldest
+// is forgotten.
+func (n *Node) dial(addr string, reply uint64) error {
+	c, err := newClient(addr, n.s.conn)
+	if err != nil || c.dest == n.Addr() {
+		return err
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	oldest := ""
+	for a, h := range n.dialing {
+		if time.Since(h.sent) > handshakeTimeout {
+			delete(n.dialing, a)
+		} else if oldest == "" || h.sent.Before(n.dialing[oldest].sent) {
+			oldest = a
+		}
+	}
+	_, known := n.peers[c.dest]
+	h, waiting := n.dialing[c.dest]
+	full := len(n.peers) >= maxPeers
+	send := !known && !full && (!waiting || reply != 0)
+	if send && !waiting {
+		if len(n.dialing) >= maxPeers {
+			delete(n.dialing, oldest)
+		}
+		h = handshake{nonce, time.Now()}
+		n.dialing[c.dest] = h
+	}
+	n.mu.Unlock()
+
+	if !send {
+		return nil
+	}
+
+	msg, err := NewMessage(HANDSHAKE, Handshake{Addr: n.Addr(), Nonce: h.nonce, Reply: reply})
+	if err != nil {
+		return err
+	}
+
+	return c.Send(msg)
+}
+
+// Check whether addr answered our HANDSHAKE with its nonce in time
+func (n *Node) answered(addr string, reply uint64) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	h, ok := n.dialing[addr]
+	return ok && reply != 0 && h.nonce == reply && time.Since(h.sent) <= handshakeTimeout
+}
+
+// Random nonce for a HANDSHAKE, never 0 since that means there is none
+func newNonce() (uint64, error) {
+	b := make([]byte, 8)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return 0, err
+		}
+		if nonce := binary.BigEndian.Uint64(b); nonce != 0 {
+			return nonce, nil
+		}
+	}
+}
+
+// Check whether we sent addr a HANDSHAKE which wasn't answered yet
+func (n *Node) isDialing(addr string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	h, ok := n.dialing[addr]
+	return ok && time.Since(h.sent) <= handshakeTimeout
+}
+
+// Send msg to a single known peer
+func (n *Node) Send(peer string, msg Message) error {
+	n.mu.RLock()
+	c, ok := n.peers[peer]
+	n.mu.RUnlock()
+
+	if !ok {
+		return errors.New("Unknown peer")
+	}
+
+	return c.Send(msg)
+}
+
+// Send msg to all known peers, returns the last error encountered
+func (n *Node) Broadcast(msg Message) error {
+	n.mu.RLock()
+	clients := make([]*client, 0, len(n.peers))
+	for _, c := range n.peers {
+		clients = append(clients, c)
+	}
+	n.mu.RUnlock()
+
+	var lastErr error
+	for _, c := range clients {
+		if err := c.Send(msg); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// Stop listening and wait for the receive loop to exit
+func (n *Node) Close() error {
+	err := n.s.close()
+	<-n.done
+	return err
+}
+
+func (n *Node) listen() {
+	defer close(n.done)
+
+	for {
+		msg, from, err := n.s.receive()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue // Drop malformed frames
+		}
+
+		if msg.Type == FRAGMENT { // Handle the message once all its fragments arrived
+			if !n.isPeer(from.String()) { // Strangers only send HANDSHAKEs, which fit in a datagram
+				continue
+			}
+			encoded, complete := n.frags.add(from.String(), msg.Payload)
+			if !complete {
+				continue
+			}
+			if msg, err = DecodeMessage(encoded); err != nil || msg.Type == FRAGMENT {
+				continue
+			}
+		}
+
+		switch msg.Type { // Only peers are listened to, and who introduces itself
+		case HANDSHAKE:
+			n.handleHandshake(from.String(), msg)
+			continue
+		case PEER_LIST:
+			n.handlePeerList(from.String(), msg)
+			continue
+		}
+		if !n.isPeer(from.String()) {
+			continue
+		}
+
+		switch msg.Type {
+		case PUBLISH:
+			n.handlePublish(from.String(), msg)
+			continue
+		case ACCOUNTS_REQUEST:
+			n.handleAccountsRequest(from.String(), msg)
+			continue
+		case ACCOUNTS_REPLY:
+			n.handleAccountsReply(from.String(), msg)
+			continue
+		case LEDGER_REQUEST:
+			n.handleLedgerRequest(from.String(), msg)
+			continue
+		case LEDGER_REPLY:
+			n.handleLedgerReply(from.String(), msg)
+			continue
+		case VOTE:
+			n.handleVote(from.String(), msg)
+			continue
+		}
+
+		if msg.Type < FIRST_EXTENSION {
+			continue
+		}
+
+		n.mu.RLock()
+		h := n.handler
+		n.mu.RUnlock()
+
+		if h != nil {
+			h(from.String(), msg)
+		}
+	}
+}
+
+// Add the sender when it answers our HANDSHAKE. A stranger gets a HANDSHAKE
+// of our own to answer first; a peer gets its nonce back, or the list of
+// peers we know when it sent none.
+func (n *Node) handleHandshake(from string, msg Message) {
+	var hs Handshake
+	if err := msg.Decode(&hs); err != nil {
+		return
+	}
+
+	if n.answered(from, hs.Reply) {
+		if n.AddPeer(from) != nil {
+			return
+		}
+	}
+	if !n.isPeer(from) {
+		n.dial(from, hs.Nonce)
+		return
+	}
+
+	if hs.Nonce != 0 {
+		if m, err := NewMessage(HANDSHAKE, Handshake{Addr: n.Addr(), Reply: hs.Nonce}); err == nil {
+			n.Send(from, m)
+		}
+		return
+	}
+
+	peers := make([]string, 0)
+	for _, p := range n.Peers() {
+		if p != from {
+			peers = append(peers, p)
+		}
+	}
+
+	m, err := NewMessage(PEER_LIST, PeerList{peers})
+	if err != nil {
+		return
+	}
+
+	n.Send(from, m)
+}
+
+// Introduce ourselves to the peers a peer knows. Lists from anyone else are
+// ignored.
+func (n *Node) handlePeerList(from string, msg Message) {
+	if !n.isPeer(from) {
+		return
+	}
+
+	var list PeerList
+	if err := msg.Decode(&list); err != nil {
+		return
+	}
 
+	for _, p := range list.Peers {
+		n.dial(p, 0)
+	}
 }
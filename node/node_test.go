@@ -0,0 +1,263 @@
+package node
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thomasbeukema/dargent/store"
+)
+
+// Two nodes on loopback introduce themselves and pass an extension message on
+// to the handler, protocol messages don't reach it
+func TestLoopbackHandler(t *testing.T) {
+	nodes := newTestNodes(t, 2)
+
+	var mu sync.Mutex
+	got := make([]Message, 0)
+	nodes[0].Handle(func(from string, msg Message) {
+		mu.Lock()
+		got = append(got, msg)
+		mu.Unlock()
+	})
+
+	ping, err := NewMessage(FIRST_EXTENSION, []string{"ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := NewMessage(PUBLISH, "not a tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[1].Send(nodes[0].Addr(), unknown); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[1].Send(nodes[0].Addr(), ping); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "extension message", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) > 0
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	var payload []string
+	if len(got) != 1 || got[0].Type != FIRST_EXTENSION || got[0].Decode(&payload) != nil || payload[0] != "ping" {
+		t.Fatal(got)
+	}
+	if peers := nodes[0].Peers(); len(peers) != 1 || peers[0] != nodes[1].Addr() {
+		t.Fatal(peers)
+	}
+}
+
+// Send msg to n from a socket which never introduced itself
+func sendRaw(t *testing.T, n *Node, msg Message) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	encoded, err := msg.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := net.ResolveUDPAddr("udp", n.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.WriteToUDP(encoded, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func TestStrangersAreNoPeers(t *testing.T) {
+	n := newTestNodes(t, 1)[0]
+
+	handled := make(chan Message, 1)
+	n.Handle(func(from string, msg Message) { handled <- msg })
+
+	ping, _ := NewMessage(FIRST_EXTENSION, "ping")
+	sendRaw(t, n, ping)
+
+	list, _ := NewMessage(PEER_LIST, PeerList{[]string{"127.0.0.1:1"}})
+	sendRaw(t, n, list)
+
+	select {
+	case msg := <-handled:
+		t.Fatal("handled message of a stranger", msg)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if peers := n.Peers(); len(peers) != 0 {
+		t.Fatal(peers)
+	}
+	if n.isDialing("127.0.0.1:1") {
+		t.Fatal("dialed address of an unsolicited list")
+	}
+}
+
+// Socket which introduced itself to n and answered its HANDSHAKE, so n
+// listens to it
+func rawPeer(t *testing.T, n *Node) *net.UDPConn {
+	t.Helper()
+
+	hello, _ := NewMessage(HANDSHAKE, Handshake{Addr: "127.0.0.1:1"})
+	conn := sendRaw(t, n, hello)
+
+	var challenge Handshake
+	msg := receive(t, conn, HANDSHAKE)
+	if err := msg.Decode(&challenge); err != nil || challenge.Nonce == 0 {
+		t.Fatal(challenge, err)
+	}
+	answer, _ := NewMessage(HANDSHAKE, Handshake{Addr: "127.0.0.1:1", Reply: challenge.Nonce})
+	sendFrom(t, conn, n, answer)
+	receive(t, conn, PEER_LIST)
+
+	return conn
+}
+
+// Send msg from conn to n
+func sendFrom(t *testing.T, conn *net.UDPConn, n *Node, msg Message) {
+	t.Helper()
+
+	encoded, err := msg.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := net.ResolveUDPAddr("udp", n.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.WriteToUDP(encoded, dest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Read datagrams from conn until one of type typ arrives
+func receive(t *testing.T, conn *net.UDPConn, typ MessageType) Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, maxDatagramSize)
+	for {
+		size, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := DecodeMessage(buf[:size])
+		if err == nil && msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+func TestHandshakeAddsPeer(t *testing.T) {
+	n := newTestNodes(t, 1)[0]
+
+	conn := rawPeer(t, n)
+
+	if peers := n.Peers(); len(peers) != 1 || peers[0] != conn.LocalAddr().String() {
+		t.Fatal(peers)
+	}
+}
+
+// A HANDSHAKE alone doesn't make a peer, so spoofed ones can't fill the table
+func TestHandshakeNeedsAnswer(t *testing.T) {
+	n := newTestNodes(t, 1)[0]
+
+	for i := 0; i < maxPeers+1; i++ {
+		hello, _ := NewMessage(HANDSHAKE, Handshake{Addr: "127.0.0.1:1"})
+		conn := sendRaw(t, n, hello)
+		receive(t, conn, HANDSHAKE)
+
+		if i == 0 { // Guessing the nonce doesn't work either
+			wrong, _ := NewMessage(HANDSHAKE, Handshake{Addr: "127.0.0.1:1", Reply: 1})
+			sendFrom(t, conn, n, wrong)
+		}
+	}
+
+	conn := rawPeer(t, n)
+	if peers := n.Peers(); len(peers) != 1 || peers[0] != conn.LocalAddr().String() {
+		t.Fatal(peers)
+	}
+}
+
+// Fragments of strangers aren't put together, so they can't push out the
+// partial messages of peers
+func TestStrangerFragmentsIgnored(t *testing.T) {
+	n := newTestNodes(t, 1)[0]
+
+	handled := make(chan Message, 1)
+	n.Handle(func(from string, msg Message) { handled <- msg })
+
+	big, _ := NewMessage(FIRST_EXTENSION, strings.Repeat("a", 2*maxDatagramSize))
+	encoded, err := big.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frags := fragment(encoded)
+
+	peer := rawPeer(t, n)
+	sendFrom(t, peer, n, frags[0])
+
+	var stranger *net.UDPConn
+	for i := 0; i < maxReassembling; i++ { // Small first halves of as many messages
+		payload := make([]byte, fragmentHeaderSize+1)
+		binary.BigEndian.PutUint64(payload[0:8], uint64(i))
+		binary.BigEndian.PutUint16(payload[10:12], 2)
+		if stranger == nil {
+			stranger = sendRaw(t, n, Message{FRAGMENT, payload})
+		} else {
+			sendFrom(t, stranger, n, Message{FRAGMENT, payload})
+		}
+	}
+
+	for _, f := range frags[1:] {
+		sendFrom(t, peer, n, f)
+	}
+
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message of peer dropped")
+	}
+}
+
+func TestPeerTableIsCapped(t *testing.T) {
+	n, err := NewNode("127.0.0.1:0", store.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	for i := 0; i < maxPeers; i++ {
+		if err := n.AddPeer("127.0.0.1:" + strconv.Itoa(10000+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := n.AddPeer("127.0.0.1:9999"); err != ErrTooManyPeers {
+		t.Fatal(err)
+	}
+	if err := n.AddPeer("127.0.0.1:10000"); err != nil { // Known already
+		t.Fatal(err)
+	}
+	if err := n.dial("127.0.0.1:9999", 0); err != nil || n.isDialing("127.0.0.1:9999") {
+		t.Fatal("dialed with a full table", err)
+	}
+	if len(n.Peers()) != maxPeers {
+		t.Fatal(len(n.Peers()))
+	}
+}
@@ -1,10 +1,51 @@
 package node
 
+import (
+	"net"
+)
+
+const (
+	// Max payload of a single UDP datagram
+	maxDatagramSize = 65507
+)
+
 type server struct {
 	addr	*net.UDPAddr
-	conn	net.UDPConn
+	conn	*net.UDPConn
+}
+
+// Start listening on host, e.g. "127.0.0.1:6660"; port 0 picks a free port
+func newServer(host string) (*server, error) {
+	addr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &server{conn.LocalAddr().(*net.UDPAddr), conn}, nil
+}
+
+// Block until the next datagram arrives and decode it
+func (s *server) receive() (Message, *net.UDPAddr, error) {
+	buf := make([]byte, maxDatagramSize)
+
+	n, from, err := s.conn.ReadFromUDP(buf)
+	if err != nil {
+		return Message{}, nil, err
+	}
+
+	msg, err := DecodeMessage(buf[:n])
+	if err != nil {
+		return Message{}, from, err
+	}
+
+	return msg, from, nil
 }
 
-func newServer(host string) {
-	//server, _ := net.ListenUDP("udp", host)
+func (s *server) close() error {
+	return s.conn.Close()
 }
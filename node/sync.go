@@ -0,0 +1,286 @@
+package node
+
+import (
+	"encoding/base64"
+
+	"github.com/thomasbeukema/dargent/account"
+	"github.com/thomasbeukema/dargent/address"
+)
+
+const (
+	// Number of accounts in a single ACCOUNTS_REPLY
+	accountsPerPage = 100
+	// Most bytes in a LEDGER_REPLY holding more than one tx; a message takes a
+	// fragment per datagram, and a burst of them overflows the socket buffer
+	ledgerReplySize = 128 << 10
+)
+
+// Ask all peers for the accounts they know. For every account the node
+// requests the ledgers it doesn't have, or only the part following the last
+// Ledger.Hash it knows, so restarting a sync is cheap.
+func (n *Node) Sync() error {
+	msg, err := NewMessage(ACCOUNTS_REQUEST, AccountsRequest{0})
+	if err != nil {
+		return err
+	}
+
+	return n.Broadcast(msg)
+}
+
+// Request one ledger of an account, continuing from what we already have
+func (n *Node) SyncLedger(peer string, addr string, currency string) error {
+	req := LedgerRequest{Address: addr, Currency: currency}
+
+	if acc, err := account.OpenAccount(n.store, addr, nil); err == nil && acc.HasLedger(currency) {
+		led, err := acc.OpenLedger(currency)
+		if err != nil {
+			return err
+		}
+		req.From = led.Hash
+	}
+
+	msg, err := NewMessage(LEDGER_REQUEST, req)
+	if err != nil {
+		return err
+	}
+
+	return n.Send(peer, msg)
+}
+
+// Answer with a page of the accounts we know
+func (n *Node) handleAccountsRequest(from string, msg Message) {
+	var req AccountsRequest
+	if err := msg.Decode(&req); err != nil || req.Offset < 0 {
+		return
+	}
+
+	addrs, err := account.ListAccounts(n.store)
+	if err != nil || req.Offset > len(addrs) {
+		return
+	}
+
+	reply := AccountsReply{Accounts: make([]AccountSummary, 0)}
+	for i, addr := range addrs[req.Offset:] {
+		if i == accountsPerPage {
+			reply.Next = req.Offset + i
+			break
+		}
+
+		acc, err := account.OpenAccount(n.store, addr, nil)
+		if err != nil {
+			continue
+		}
+		currencies, err := acc.Ledgers()
+		if err != nil {
+			continue
+		}
+		reply.Accounts = append(reply.Accounts, AccountSummary{addr, currencies})
+	}
+
+	if m, err := NewMessage(ACCOUNTS_REPLY, reply); err == nil {
+		n.Send(from, m)
+	}
+}
+
+// Request every ledger in the page and the next page if there is one
+func (n *Node) handleAccountsReply(from string, msg Message) {
+	var reply AccountsReply
+	if err := msg.Decode(&reply); err != nil {
+		return
+	}
+
+	for _, summary := range reply.Accounts {
+		if address.TypeOfAddress(summary.Address) == address.UNKNOWN {
+			continue
+		}
+		for _, currency := range summary.Currencies {
+			n.SyncLedger(from, summary.Address, currency)
+		}
+	}
+
+	if reply.Next > 0 {
+		if m, err := NewMessage(ACCOUNTS_REQUEST, AccountsRequest{reply.Next}); err == nil {
+			n.Send(from, m)
+		}
+	}
+}
+
+// Answer with the transactions following req.From, split over multiple
+// replies when they don't fit in one message
+func (n *Node) handleLedgerRequest(from string, msg Message) {
+	var req LedgerRequest
+	if err := msg.Decode(&req); err != nil {
+		return
+	}
+
+	acc, err := account.OpenAccount(n.store, req.Address, nil)
+	if err != nil || !acc.HasLedger(req.Currency) {
+		return
+	}
+	led, err := acc.OpenLedger(req.Currency)
+	if err != nil {
+		return
+	}
+
+	start := 0
+	if req.From != "" {
+		start = led.OffsetOf(req.From)
+		if start < 0 { // Their copy doesn't match ours, send everything
+			req.From = ""
+			start = 0
+		}
+	}
+
+	remaining := led.TxList[start:]
+	count := len(remaining)
+
+	for {
+		reply := LedgerReply{
+			Address: req.Address,
+			Currency: req.Currency,
+			From: req.From,
+			TxList: remaining[:count],
+			Hash: led.Hash,
+			More: count < len(remaining),
+		}
+		if !reply.More {
+			reply.Signature = led.Signature
+		}
+
+		m, err := NewMessage(LEDGER_REPLY, reply)
+		if (err == ErrTooLarge || err == nil && len(m.Payload) > ledgerReplySize) && count > 1 {
+			count = count / 2
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		n.Send(from, m)
+		return
+	}
+}
+
+// Verify the received transactions and store them when they extend our copy
+// of the ledger
+func (n *Node) handleLedgerReply(from string, msg Message) {
+	var reply LedgerReply
+	if err := msg.Decode(&reply); err != nil {
+		return
+	}
+
+	n.writes.Lock() // Our copy can't change between comparing and writing
+	defer n.writes.Unlock()
+
+	var acc account.Account
+	var local account.Ledger
+	exists := account.AccountExists(n.store, reply.Address)
+
+	if exists {
+		var err error
+		if acc, err = account.OpenAccount(n.store, reply.Address, nil); err != nil {
+			return
+		}
+		if acc.HasLedger(reply.Currency) {
+			if local, err = acc.OpenLedger(reply.Currency); err != nil {
+				return
+			}
+		}
+	} else { // New account, the first transaction tells us its public key
+		if len(reply.TxList) == 0 || reply.TxList[0].Action != account.CREATE {
+			return
+		}
+		pubkey, err := base64.StdEncoding.DecodeString(reply.TxList[0].Origin)
+		if err != nil || address.PubKeyToAddress(pubkey) != reply.Address {
+			return
+		}
+		acc = account.Account{
+			Type: address.TypeOfAddress(reply.Address),
+			PublicKey: pubkey,
+			Address: reply.Address,
+		}
+	}
+
+	if len(reply.TxList) == 0 && reply.Signature == local.Signature { // Nothing new
+		return
+	}
+
+	for _, tx := range reply.TxList { // All of it has to belong in the ledger it's sent as
+		if tx.Currency.Ticker != reply.Currency {
+			return
+		}
+	}
+
+	var txs []account.Transaction
+	if reply.From == local.Hash { // Continues our copy
+		txs = append(append(txs, local.TxList...), reply.TxList...)
+	} else if reply.From == "" && isPrefix(local.TxList, reply.TxList) {
+		txs = reply.TxList
+	} else {
+		return
+	}
+
+	candidate := account.Ledger{Currency: reply.Currency, TxList: txs, Forks: local.Forks}
+	candidate.CalculateHash()
+
+	if !reply.More && candidate.Hash != reply.Hash {
+		return
+	}
+	if !candidate.VerifyChain(&acc) {
+		return
+	}
+
+	signature, more := reply.Signature, reply.More
+	backed, err := candidate.BackedLength(n.store, reply.Address)
+	if err != nil {
+		return
+	}
+	if backed < len(candidate.TxList) { // Keep the txs before a CLAIM of a SEND we don't know; a later Sync gets the rest
+		if backed <= len(local.TxList) {
+			return
+		}
+		candidate = account.Ledger{Currency: reply.Currency, TxList: txs[:backed], Forks: local.Forks}
+		candidate.CalculateHash()
+		signature, more = "", false // Signed the whole ledger
+	}
+
+	if !exists {
+		var err error
+		if acc, err = account.OpenAccount(n.store, reply.Address, acc.PublicKey); err != nil {
+			return
+		}
+	}
+	if _, err := acc.OpenLedger(reply.Currency); err != nil { // Make sure the ledger exists on disk
+		return
+	}
+
+	if signature != "" {
+		if err := candidate.UpdateSignature(signature, &acc); err != nil {
+			return
+		}
+	} else if err := candidate.Write(&acc); err != nil {
+		return
+	}
+	if err := candidate.UpdatePending(&acc); err != nil {
+		return
+	}
+
+	if more {
+		n.SyncLedger(from, reply.Address, reply.Currency)
+	}
+}
+
+// Check whether a is the start of b
+func isPrefix(a, b []account.Transaction) bool {
+	if len(a) > len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Hash != b[i].Hash {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,220 @@
+package node
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/thomasbeukema/dargent/account"
+	"github.com/thomasbeukema/dargent/address"
+)
+
+// Ledger.Hash of the native ledger of addr on n
+func ledgerHash(n *Node, addr string) string {
+	acc, err := account.OpenAccount(n.store, addr, nil)
+	if err != nil || !acc.HasLedger(account.NativeCurrency().Ticker) {
+		return ""
+	}
+
+	led, err := acc.OpenLedger(account.NativeCurrency().Ticker)
+	if err != nil {
+		return ""
+	}
+
+	return led.Hash
+}
+
+// Store txs on n without passing them on
+func applyAll(t *testing.T, n *Node, txs ...account.Transaction) {
+	t.Helper()
+
+	for _, tx := range txs {
+		if err := n.applyTransaction(tx); err != nil {
+			t.Fatal(tx.Action, err)
+		}
+	}
+}
+
+func TestSyncBootstrapsEmptyNode(t *testing.T) {
+	nodes := newTestNodes(t, 2)
+	full, empty := nodes[0], nodes[1]
+	genesis, send, create, claim := testChain(t)
+	applyAll(t, full, genesis, send, create, claim)
+
+	if err := empty.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "genesis ledger", func() bool { return lastHash(empty, genesis.AccountAddress()) == lastHash(full, genesis.AccountAddress()) })
+
+	// The CLAIM is kept back when its ledger arrived before the SEND; the
+	// next Sync continues from what is there
+	if err := empty.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "claiming ledger", func() bool { return lastHash(empty, claim.AccountAddress()) == lastHash(full, claim.AccountAddress()) })
+
+	waitFor(t, "claimed SEND to leave pending", func() bool {
+		pending, err := account.PendingFor(empty.store, claim.AccountAddress(), account.NativeCurrency().Ticker)
+		return err == nil && len(pending) == 0
+	})
+}
+
+func TestLedgerRequestFromHash(t *testing.T) {
+	n := newTestNodes(t, 1)[0]
+	genesis, send, _, _ := testChain(t)
+	applyAll(t, n, genesis)
+
+	from := ledgerHash(n, genesis.AccountAddress())
+	applyAll(t, n, send)
+
+	peer := rawPeer(t, n)
+	req, _ := NewMessage(LEDGER_REQUEST, LedgerRequest{genesis.AccountAddress(), account.NativeCurrency().Ticker, from})
+	sendFrom(t, peer, n, req)
+
+	var reply LedgerReply
+	msg := receive(t, peer, LEDGER_REPLY)
+	if err := msg.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.From != from || len(reply.TxList) != 1 || reply.TxList[0].Hash != send.Hash || reply.More {
+		t.Fatalf("from %q: %+v", from, reply)
+	}
+	if reply.Hash != ledgerHash(n, genesis.AccountAddress()) {
+		t.Fatal("reply doesn't carry the ledger hash")
+	}
+}
+
+func TestSyncLedgerResumes(t *testing.T) {
+	n := newTestNodes(t, 1)[0]
+	genesis, send, _, _ := testChain(t)
+	applyAll(t, n, genesis)
+
+	peer := rawPeer(t, n)
+	if err := n.SyncLedger(peer.LocalAddr().String(), genesis.AccountAddress(), account.NativeCurrency().Ticker); err != nil {
+		t.Fatal(err)
+	}
+
+	var req LedgerRequest
+	msg := receive(t, peer, LEDGER_REQUEST)
+	if err := msg.Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.From == "" || req.From != ledgerHash(n, genesis.AccountAddress()) {
+		t.Fatalf("request from %q", req.From)
+	}
+
+	full := account.Ledger{TxList: []account.Transaction{genesis, send}}
+	full.CalculateHash()
+	reply, _ := NewMessage(LEDGER_REPLY, LedgerReply{
+		Address: req.Address,
+		Currency: req.Currency,
+		From: req.From,
+		TxList: []account.Transaction{send},
+		Hash: full.Hash,
+	})
+	sendFrom(t, peer, n, reply)
+
+	waitFor(t, "ledger to continue", func() bool { return ledgerLength(n, genesis.AccountAddress()) == 2 })
+}
+
+func TestSyncLedgerInPages(t *testing.T) {
+	nodes := newTestNodes(t, 2)
+	full, empty := nodes[0], nodes[1]
+
+	// SPHINCS signatures make every tx big, so the ledger needs several replies
+	ecc := testKey(t, 3)
+	var sphincs [2]address.SPHINCSKeyPair
+	for i := range sphincs {
+		entropy := make([]byte, 32)
+		entropy[0] = byte(i)
+		var err error
+		if sphincs[i], err = address.GenerateSPHINCSKeyPair(entropy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key, err := address.NewMultisigKey(2, ecc, sphincs[0], sphincs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosign := func(tx account.Transaction) account.Transaction {
+		var partials []address.PartialSignature
+		for _, signer := range []address.Signer{sphincs[0], sphincs[1]} {
+			p, err := tx.SignPartial(key, signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			partials = append(partials, p)
+		}
+		if err := tx.Sign(address.Cosigned{MultisigKey: key, Partials: partials}); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	txs := []account.Transaction{cosign(account.Transaction{
+		Action: account.CREATE,
+		Currency: account.NativeCurrency(),
+		Origin: base64.StdEncoding.EncodeToString(key.GetPublicKey()),
+	})}
+	size := 0
+	for size <= 3*ledgerReplySize {
+		tx := cosign(account.Transaction{
+			Action: account.DELEGATE,
+			Currency: account.NativeCurrency(),
+			PreviousHash: txs[len(txs)-1].Hash,
+			Origin: key.GetAddress(),
+			Destination: testKey(t, 1).GetAddress(),
+		})
+		txs = append(txs, tx)
+
+		msg, err := NewMessage(PUBLISH, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += len(msg.Payload)
+	}
+	applyAll(t, full, txs...)
+
+	if err := empty.SyncLedger(full.Addr(), key.GetAddress(), account.NativeCurrency().Ticker); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "all pages", func() bool { return ledgerLength(empty, key.GetAddress()) == len(txs) })
+
+	if ledgerHash(empty, key.GetAddress()) != ledgerHash(full, key.GetAddress()) {
+		t.Fatal("synced ledger differs")
+	}
+}
+
+func TestLedgerReplyOfOtherCurrency(t *testing.T) {
+	n := newTestNodes(t, 1)[0]
+	genesis, _, _, _ := testChain(t)
+
+	led := account.Ledger{TxList: []account.Transaction{genesis}}
+	led.CalculateHash()
+	reply, _ := NewMessage(LEDGER_REPLY, LedgerReply{
+		Address: genesis.AccountAddress(),
+		Currency: "FOO",
+		TxList: led.TxList,
+		Hash: led.Hash,
+	})
+	peer := rawPeer(t, n)
+	sendFrom(t, peer, n, reply)
+
+	// Followed by a valid reply, so the first one has been handled once this
+	// one is stored
+	reply, _ = NewMessage(LEDGER_REPLY, LedgerReply{
+		Address: genesis.AccountAddress(),
+		Currency: account.NativeCurrency().Ticker,
+		TxList: led.TxList,
+		Hash: led.Hash,
+	})
+	sendFrom(t, peer, n, reply)
+	waitFor(t, "valid reply", func() bool { return ledgerLength(n, genesis.AccountAddress()) == 1 })
+
+	acc, err := account.OpenAccount(n.store, genesis.AccountAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.HasLedger("FOO") {
+		t.Fatal("stored ART txs as ledger FOO")
+	}
+}
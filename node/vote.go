@@ -0,0 +1,95 @@
+package node
+
+import (
+	"github.com/thomasbeukema/dargent/account"
+	"github.com/thomasbeukema/dargent/address"
+)
+
+// Let the node vote on every tx it accepts, as the representative owning signer
+func (n *Node) SetRepresentative(signer address.Signer) {
+	n.mu.Lock()
+	n.rep = signer
+	n.mu.Unlock()
+}
+
+// Get the votes the node collected for a tx
+func (n *Node) Election(hash string) (account.Election, bool) {
+	return n.tally.Election(hash)
+}
+
+// Start the election for an accepted tx and cast our own vote
+func (n *Node) vote(tx account.Transaction) error {
+	n.writes.Lock() // Confirming writes the ledger
+	n.tally.Start(tx)
+	n.writes.Unlock()
+
+	n.mu.RLock()
+	rep := n.rep
+	n.mu.RUnlock()
+
+	if rep == nil {
+		return nil
+	}
+
+	v, err := account.NewVote(rep, tx.Hash)
+	if err != nil {
+		return err
+	}
+	n.markSeen(voteKey(v))
+	n.addVote(v)
+
+	return n.forwardVote(v, "")
+}
+
+// Count a vote received from a peer and pass it on
+func (n *Node) handleVote(from string, msg Message) {
+	var v account.Vote
+	if err := msg.Decode(&v); err != nil {
+		return
+	}
+
+	if n.isSeen(voteKey(v)) {
+		return
+	}
+
+	// Only a valid vote is marked seen, a forged one mustn't keep out the real one
+	if !v.Verify(n.store) || !n.markSeen(voteKey(v)) {
+		return
+	}
+
+	n.addVote(v)
+	n.forwardVote(v, from)
+}
+
+// Count v, which may confirm its tx in the ledger
+func (n *Node) addVote(v account.Vote) {
+	n.writes.Lock()
+	defer n.writes.Unlock()
+
+	n.tally.AddVote(v)
+}
+
+// Send vote to every peer except the one we got it from
+func (n *Node) forwardVote(v account.Vote, from string) error {
+	msg, err := NewMessage(VOTE, v)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, p := range n.Peers() {
+		if p == from {
+			continue
+		}
+		if err := n.Send(p, msg); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// Votes share the seen set with txs
+func voteKey(v account.Vote) string {
+	return "vote:" + v.Representative + ":" + v.TxHash
+}
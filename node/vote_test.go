@@ -0,0 +1,41 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/thomasbeukema/dargent/account"
+)
+
+// A vote with a bad signature doesn't keep the real vote of the
+// representative out
+func TestForgedVoteDoesntSuppressReal(t *testing.T) {
+	nodes := newTestNodes(t, 2)
+	genesis, send, _, _ := testChain(t)
+	rep := testKey(t, 1) // Owns the genesis account
+
+	if err := nodes[0].PublishTransaction(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	real, err := account.NewVote(rep, send.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _ := account.NewVote(testKey(t, 9), send.Hash)
+	forged.Representative = real.Representative
+
+	for _, v := range []account.Vote{forged, real} {
+		msg, err := NewMessage(VOTE, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := nodes[1].Send(nodes[0].Addr(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, "real vote", func() bool {
+		e, ok := nodes[0].Election(send.Hash)
+		return ok && e.Votes[real.Representative].Signature == real.Signature
+	})
+}
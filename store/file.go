@@ -0,0 +1,161 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix of the files Put writes to before moving them into place
+const tempPrefix = ".tmp-"
+
+// Store which keeps every key in its own file below a directory
+type FileStore struct {
+	dir	string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir}
+}
+
+func (f *FileStore) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(key))
+}
+
+func (f *FileStore) Get(key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrNotFound
+	}
+
+	value, err := ioutil.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return value, err
+}
+
+// Write value to a temporary file, sync it and move it into place, so a crash
+// leaves either the old or the new value but never half of it
+func (f *FileStore) Put(key string, value []byte) error {
+	if !validKey(key) {
+		return errors.New("Invalid key")
+	}
+
+	path := f.path(key)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, tempPrefix+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// Append value to the file of key and sync it
+func (f *FileStore) Append(key string, value []byte) error {
+	if !validKey(key) {
+		return errors.New("Invalid key")
+	}
+
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(value); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (f *FileStore) Delete(key string) error {
+	if !validKey(key) {
+		return nil
+	}
+
+	err := os.Remove(f.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (f *FileStore) List(prefix string) ([]string, error) {
+	path := f.dir
+	if prefix != "" {
+		if !validKey(prefix) {
+			return []string{}, nil
+		}
+		path = f.path(prefix)
+	}
+
+	names := make([]string, 0)
+
+	entries, err := ioutil.ReadDir(path)
+	if os.IsNotExist(err) { // Nothing stored yet
+		return names, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), tempPrefix) { // Left behind by a crash
+			continue
+		}
+		names = append(names, e.Name())
+	}
+
+	return names, nil
+}
+
+// Make a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	d.Sync() // Not supported everywhere, the rename itself already happened
+
+	return nil
+}
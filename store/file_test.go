@@ -0,0 +1,71 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Readers see either the old or the new value of a key, never a mix or part
+// of it
+func TestFileStorePutIsAtomic(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+	values := [][]byte{bytes.Repeat([]byte("a"), 1<<20), bytes.Repeat([]byte("b"), 1<<20)}
+	if err := s.Put("acc/index", values[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := s.Put("acc/index", values[i%2]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		got, err := s.Get("acc/index")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, values[0]) && !bytes.Equal(got, values[1]) {
+			t.Fatalf("read %d bytes of a half written value", len(got))
+		}
+	}
+	wg.Wait()
+}
+
+// A temporary file left by a crash during Put is no key, and the old value is
+// still there
+func TestFileStoreIgnoresCrashedPut(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStore(dir)
+	if err := s.Put("acc/index", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "acc", tempPrefix+"index123"), []byte("ne"), 0644)
+
+	if names, _ := s.List("acc"); len(names) != 1 || names[0] != "index" {
+		t.Fatal(names)
+	}
+	if got, _ := s.Get("acc/index"); string(got) != "old" {
+		t.Fatal(string(got))
+	}
+}
+
+func TestFileStoreRejectsEscapingKeys(t *testing.T) {
+	s := NewFileStore(t.TempDir())
+
+	for _, key := range []string{"../x", "/x", "a//b", "a/./b", ""} {
+		if err := s.Put(key, []byte("x")); err == nil {
+			t.Errorf("put %q", key)
+		}
+	}
+}
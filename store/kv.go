@@ -0,0 +1,354 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	opPut byte = iota
+	opDelete
+	opAppend // Value continues the one stored before
+)
+
+const (
+	// crc + op + key length + value length
+	recordHeaderSize = 4 + 1 + 4 + 4
+
+	maxKeySize = 1 << 16
+	maxValueSize = 1 << 30
+
+	// The file is compacted once it's this many times larger than the
+	// records still in use, and at least minCompactSize
+	compactRatio = 2
+	minCompactSize = 1 << 20
+)
+
+var (
+	ErrCorrupt = errors.New("Corrupt record in store")
+	ErrTooLarge = errors.New("Key or value too large")
+)
+
+// Embedded key-value store keeping everything in a single append-only file.
+// Every Put and Delete appends a record and the last record of a key wins;
+// Append adds a record holding only the new part. The index of keys to their
+// values in the file is rebuilt when opening the file; a torn record at the
+// end, left by a crash, is cut off. The file is compacted when most of it is
+// outdated.
+type KVStore struct {
+	path	string
+	f		*os.File
+	size	int64
+	live	int64 // Bytes of the records the index points to
+	index	map[string]kvEntry
+	mu		sync.RWMutex
+}
+
+// Where the value of a key lives in the file; appended values are spread
+// over multiple records
+type kvEntry struct {
+	parts	[]kvPart
+	length	int64
+	records	int64 // Size of the records holding the parts
+}
+
+type kvPart struct {
+	offset	int64
+	length	uint32
+}
+
+// Open or create the store in the file at path
+func OpenKVStore(path string) (*KVStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := &KVStore{path: path, f: f, index: make(map[string]kvEntry)}
+	if err := kv.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return kv, nil
+}
+
+// Read all records to build the index. Only a torn record at the end is cut
+// off; a bad record followed by more data means the file got damaged, and
+// the store isn't opened rather than losing everything after it.
+func (kv *KVStore) load() error {
+	info, err := kv.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(kv.f)
+	var offset int64
+
+	for {
+		op, key, value, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var torn *tornRecord
+			if !errors.As(err, &torn) || offset+torn.size < info.Size() {
+				return fmt.Errorf("%w: at offset %d of %s: %v", ErrCorrupt, offset, kv.path, err)
+			}
+			break // Cut off by a crash while writing it
+		}
+
+		kv.apply(op, key, offset, uint32(len(value)))
+		offset += int64(recordHeaderSize + len(key) + len(value))
+	}
+
+	kv.size = offset
+	if err := kv.f.Truncate(offset); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Record at the end of the file which wasn't written completely; size is
+// what its header claims, or just the header when even that is incomplete
+type tornRecord struct {
+	size	int64
+}
+
+func (t *tornRecord) Error() string {
+	return "Incomplete record"
+}
+
+func readRecord(r io.Reader) (byte, string, []byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err == io.ErrUnexpectedEOF {
+		return 0, "", nil, &tornRecord{recordHeaderSize}
+	} else if err != nil {
+		return 0, "", nil, err
+	}
+
+	op := header[4]
+	keyLength := binary.BigEndian.Uint32(header[5:9])
+	valueLength := binary.BigEndian.Uint32(header[9:13])
+	if op > opAppend || keyLength > maxKeySize || valueLength > maxValueSize {
+		return 0, "", nil, errors.New("Invalid record header")
+	}
+	size := int64(recordHeaderSize) + int64(keyLength) + int64(valueLength)
+
+	body := make([]byte, int(keyLength)+int(valueLength))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, "", nil, &tornRecord{size}
+	}
+
+	if crc32.ChecksumIEEE(append(header[4:], body...)) != binary.BigEndian.Uint32(header[:4]) {
+		return 0, "", nil, &tornRecord{size} // Only torn when it's the last record
+	}
+
+	return op, string(body[:keyLength]), body[keyLength:], nil
+}
+
+func encodeRecord(op byte, key string, value []byte) []byte {
+	b := make([]byte, recordHeaderSize+len(key)+len(value))
+	b[4] = op
+	binary.BigEndian.PutUint32(b[5:9], uint32(len(key)))
+	binary.BigEndian.PutUint32(b[9:13], uint32(len(value)))
+	copy(b[recordHeaderSize:], key)
+	copy(b[recordHeaderSize+len(key):], value)
+	binary.BigEndian.PutUint32(b[:4], crc32.ChecksumIEEE(b[4:]))
+
+	return b
+}
+
+// Update the index for a record at offset
+func (kv *KVStore) apply(op byte, key string, offset int64, length uint32) {
+	records := int64(recordHeaderSize+len(key)) + int64(length)
+	part := kvPart{offset + recordHeaderSize + int64(len(key)), length}
+	old, exists := kv.index[key]
+
+	switch op {
+	case opPut:
+		kv.live -= old.records
+		kv.index[key] = kvEntry{[]kvPart{part}, int64(length), records}
+		kv.live += records
+	case opAppend:
+		old.parts = append(old.parts, part)
+		old.length += int64(length)
+		old.records += records
+		kv.index[key] = old
+		kv.live += records
+	case opDelete:
+		if exists {
+			kv.live -= old.records
+			delete(kv.index, key)
+		}
+	}
+}
+
+// Append a record and sync it to disk
+func (kv *KVStore) append(op byte, key string, value []byte) error {
+	record := encodeRecord(op, key, value)
+
+	if _, err := kv.f.WriteAt(record, kv.size); err != nil {
+		return err
+	}
+	if err := kv.f.Sync(); err != nil {
+		return err
+	}
+
+	kv.apply(op, key, kv.size, uint32(len(value)))
+	kv.size += int64(len(record))
+
+	if kv.size > minCompactSize && kv.size > compactRatio*kv.live {
+		return kv.compact()
+	}
+
+	return nil
+}
+
+// Read the value of e from the file
+func (kv *KVStore) read(e kvEntry) ([]byte, error) {
+	value := make([]byte, e.length)
+
+	var n int64
+	for _, part := range e.parts {
+		if _, err := kv.f.ReadAt(value[n:n+int64(part.length)], part.offset); err != nil {
+			return nil, err
+		}
+		n += int64(part.length)
+	}
+
+	return value, nil
+}
+
+func (kv *KVStore) Get(key string) ([]byte, error) {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+
+	e, ok := kv.index[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return kv.read(e)
+}
+
+func (kv *KVStore) Put(key string, value []byte) error {
+	if !validKey(key) {
+		return errors.New("Invalid key")
+	}
+	if len(key) > maxKeySize || len(value) > maxValueSize { // Couldn't be read back
+		return ErrTooLarge
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	return kv.append(opPut, key, value)
+}
+
+// Only the new part is written, the value is put back together on reading
+func (kv *KVStore) Append(key string, value []byte) error {
+	if !validKey(key) {
+		return errors.New("Invalid key")
+	}
+	if len(key) > maxKeySize {
+		return ErrTooLarge
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	e := kv.index[key]
+	if e.length+int64(len(value)) > maxValueSize { // Has to fit in one record when compacting
+		return ErrTooLarge
+	}
+
+	return kv.append(opAppend, key, value)
+}
+
+func (kv *KVStore) Delete(key string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if _, ok := kv.index[key]; !ok {
+		return nil
+	}
+
+	return kv.append(opDelete, key, nil)
+}
+
+func (kv *KVStore) List(prefix string) ([]string, error) {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+
+	keys := make(map[string][]byte, len(kv.index))
+	for key := range kv.index {
+		keys[key] = nil
+	}
+
+	return listKeys(keys, prefix), nil
+}
+
+// Rewrite the file with only the current value of every key
+func (kv *KVStore) Compact() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	return kv.compact()
+}
+
+func (kv *KVStore) compact() error {
+	tmp, err := os.OpenFile(kv.path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]kvEntry, len(kv.index))
+	var size int64
+
+	for key, e := range kv.index {
+		value, err := kv.read(e)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+
+		record := encodeRecord(opPut, key, value)
+		if _, err := tmp.WriteAt(record, size); err != nil {
+			tmp.Close()
+			return err
+		}
+
+		part := kvPart{size + recordHeaderSize + int64(len(key)), uint32(len(value))}
+		index[key] = kvEntry{[]kvPart{part}, e.length, int64(len(record))}
+		size += int64(len(record))
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), kv.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	kv.f.Close()
+	kv.f, kv.index, kv.size, kv.live = tmp, index, size, size
+
+	return nil
+}
+
+func (kv *KVStore) Close() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	return kv.f.Close()
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestKV(t *testing.T, path string) *KVStore {
+	t.Helper()
+
+	kv, err := OpenKVStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { kv.Close() })
+
+	return kv
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info.Size()
+}
+
+func TestKVStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv")
+	kv := openTestKV(t, path)
+
+	kv.Put("a/index", []byte("one"))
+	kv.Put("a/index", []byte("two"))
+	kv.Append("a/journal", []byte("x"))
+	kv.Append("a/journal", []byte("yz"))
+	kv.Put("b", []byte("gone"))
+	kv.Delete("b")
+	kv.Close()
+
+	kv = openTestKV(t, path)
+	for key, want := range map[string]string{"a/index": "two", "a/journal": "xyz"} {
+		if got, err := kv.Get(key); err != nil || string(got) != want {
+			t.Errorf("%s: %q, %v", key, got, err)
+		}
+	}
+	if _, err := kv.Get("b"); err != ErrNotFound {
+		t.Fatal("deleted key came back")
+	}
+}
+
+// Appending writes only the new part, so the file grows with what's appended
+func TestKVStoreAppendIsLinear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv")
+	kv := openTestKV(t, path)
+
+	chunk := bytes.Repeat([]byte{1}, 100)
+	for i := 0; i < 1000; i++ {
+		if err := kv.Append("journal", chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if size, max := fileSize(t, path), int64(1000*(recordHeaderSize+len("journal")+len(chunk))); size > max {
+		t.Fatalf("file of %d bytes, want at most %d", size, max)
+	}
+	if got, _ := kv.Get("journal"); len(got) != 1000*len(chunk) {
+		t.Fatalf("%d bytes appended", len(got))
+	}
+}
+
+// Overwriting the same key over and over doesn't grow the file forever
+func TestKVStoreCompactsItself(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv")
+	kv := openTestKV(t, path)
+
+	value := bytes.Repeat([]byte{2}, 64<<10)
+	for i := 0; i < 100; i++ { // 6.4 MiB written
+		value[0] = byte(i)
+		if err := kv.Put("index", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if size := fileSize(t, path); size > compactRatio*minCompactSize {
+		t.Fatalf("file of %d bytes for %d bytes of data", size, len(value))
+	}
+	if got, _ := kv.Get("index"); !bytes.Equal(got, value) {
+		t.Fatal("value changed by compacting")
+	}
+}
+
+func TestKVStoreCutsTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv")
+	kv := openTestKV(t, path)
+	kv.Put("a", []byte("kept"))
+	kv.Put("b", []byte("torn"))
+	kv.Close()
+
+	size := fileSize(t, path)
+	if err := os.Truncate(path, size-2); err != nil { // Crash while writing b
+		t.Fatal(err)
+	}
+
+	kv = openTestKV(t, path)
+	if got, err := kv.Get("a"); err != nil || string(got) != "kept" {
+		t.Fatal(got, err)
+	}
+	if _, err := kv.Get("b"); err != ErrNotFound {
+		t.Fatal("torn record read")
+	}
+
+	if err := kv.Put("c", []byte("after")); err != nil { // Written where the torn record was
+		t.Fatal(err)
+	}
+	kv.Close()
+	kv = openTestKV(t, path)
+	if got, err := kv.Get("c"); err != nil || string(got) != "after" {
+		t.Fatal(got, err)
+	}
+}
+
+// A damaged record in the middle stops opening the store, instead of cutting
+// off every record after it
+func TestKVStoreKeepsFileWithCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv")
+	kv := openTestKV(t, path)
+	kv.Put("a", []byte("first"))
+	kv.Put("b", []byte("second"))
+	kv.Close()
+
+	raw, _ := ioutil.ReadFile(path)
+	raw[recordHeaderSize+1] ^= 0xff // Key of the first record
+	ioutil.WriteFile(path, raw, 0644)
+
+	if _, err := OpenKVStore(path); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("got %v, want ErrCorrupt", err)
+	}
+	if after, _ := ioutil.ReadFile(path); !bytes.Equal(after, raw) {
+		t.Fatal("file changed")
+	}
+}
+
+func TestKVStoreRejectsTooLarge(t *testing.T) {
+	kv := openTestKV(t, filepath.Join(t.TempDir(), "kv"))
+
+	key := strings.Repeat("k", maxKeySize+1)
+	if err := kv.Put(key, nil); err != ErrTooLarge {
+		t.Fatalf("Put: got %v, want ErrTooLarge", err)
+	}
+	if err := kv.Append(key, nil); err != ErrTooLarge {
+		t.Fatalf("Append: got %v, want ErrTooLarge", err)
+	}
+}
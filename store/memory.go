@@ -0,0 +1,86 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Store which only lives in memory, for tests and nodes which don't need to
+// survive a restart
+type MemoryStore struct {
+	data	map[string][]byte
+	mu		sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+func (m *MemoryStore) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+func (m *MemoryStore) Put(key string, value []byte) error {
+	if !validKey(key) {
+		return errors.New("Invalid key")
+	}
+
+	m.mu.Lock()
+	m.data[key] = append([]byte{}, value...)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryStore) Append(key string, value []byte) error {
+	if !validKey(key) {
+		return errors.New("Invalid key")
+	}
+
+	m.mu.Lock()
+	m.data[key] = append(append([]byte{}, m.data[key]...), value...)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	delete(m.data, key)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *MemoryStore) List(prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return listKeys(m.data, prefix), nil
+}
+
+// Sorted names directly below prefix in a flat set of keys
+func listKeys(keys map[string][]byte, prefix string) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+
+	for key := range keys {
+		if name, ok := childOf(key, prefix); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
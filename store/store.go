@@ -0,0 +1,66 @@
+package store
+
+import (
+	"errors"
+	"strings"
+)
+
+// Returned by Get when there is nothing stored under a key
+var ErrNotFound = errors.New("Key not found")
+
+// Storage for everything a node keeps, e.g. accounts and their ledgers. Keys
+// are slash separated paths like "<address>/<currency>/index.json.gz", which
+// the filesystem implementation maps onto directories.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+	// Add value to the end of what's stored under key, creating it if needed.
+	// Used for journals, so it has to be durable when it returns.
+	Append(key string, value []byte) error
+	// Names of everything directly below prefix, "" lists the root
+	List(prefix string) ([]string, error)
+}
+
+// Check whether anything is stored under key
+func Exists(s Store, key string) bool {
+	_, err := s.Get(key)
+	return err == nil
+}
+
+// Build a key from its parts
+func Key(parts ...string) string {
+	return strings.Join(parts, "/")
+}
+
+// Name of the first part of key below prefix, used to implement List on top of
+// a flat set of keys
+func childOf(key string, prefix string) (string, bool) {
+	if prefix != "" {
+		if !strings.HasPrefix(key, prefix+"/") {
+			return "", false
+		}
+		key = key[len(prefix)+1:]
+	}
+
+	if i := strings.Index(key, "/"); i >= 0 {
+		key = key[:i]
+	}
+
+	return key, key != ""
+}
+
+// Keys may not escape the root of the store
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+
+	return true
+}